@@ -0,0 +1,214 @@
+package shadow
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAgeInfinite is the maximum password age from which shadow-utils
+// considers a password to never expire.
+const maxAgeInfinite = 10000
+
+// ExpiryState is the result of checking an entry for expiry, with the
+// same meaning as the values returned by isexpired() in shadow-utils.
+type ExpiryState int
+
+// The states are ordered by severity.  A user whose password has
+// expired may still log in, but must change it first.
+const (
+	ExpiryNone ExpiryState = iota
+	ExpiryPassword
+	ExpiryInactive
+	ExpiryAccount
+)
+
+func (s ExpiryState) String() string {
+	switch s {
+	case ExpiryNone:
+		return "ok"
+	case ExpiryPassword:
+		return "password expired"
+	case ExpiryInactive:
+		return "password inactive"
+	case ExpiryAccount:
+		return "account expired"
+	default:
+		return "unknown"
+	}
+}
+
+// Aging is the interpretation of the aging fields of a ShadowEntry,
+// as shown by `chage -l`.  Dates that do not apply, for example the
+// expiry of a password without a maximum age, are left as the zero
+// time with their Has flag cleared.
+type Aging struct {
+	LastChanged      time.Time
+	PasswordExpires  time.Time
+	WarningStarts    time.Time
+	PasswordInactive time.Time
+	AccountExpires   time.Time
+
+	HasLastChanged      bool
+	HasPasswordExpires  bool
+	HasWarningStarts    bool
+	HasPasswordInactive bool
+	HasAccountExpires   bool
+
+	// MustChange is set when the date of the last change is the
+	// epoch, which forces a password change at the next login.
+	MustChange bool
+
+	// The ages are -1 when not set, as printed by chage.
+	MinimumAge  int
+	MaximumAge  int
+	WarningDays int
+}
+
+// String formats the aging information in the same way as `chage -l`.
+func (a Aging) String() string {
+	date := func(t time.Time, b bool) string {
+		if !b {
+			return "never"
+		}
+		return t.Format("Jan 02, 2006")
+	}
+	orChange := func(s string) string {
+		if a.MustChange {
+			return "password must be changed"
+		}
+		return s
+	}
+
+	out := new(strings.Builder)
+	out.WriteString("Last password change\t\t\t\t\t: " + orChange(date(a.LastChanged, a.HasLastChanged)) + "\n")
+	out.WriteString("Password expires\t\t\t\t\t: " + orChange(date(a.PasswordExpires, a.HasPasswordExpires)) + "\n")
+	out.WriteString("Password inactive\t\t\t\t\t: " + orChange(date(a.PasswordInactive, a.HasPasswordInactive)) + "\n")
+	out.WriteString("Account expires\t\t\t\t\t\t: " + date(a.AccountExpires, a.HasAccountExpires) + "\n")
+	out.WriteString("Minimum number of days between password change\t\t: " + strconv.Itoa(a.MinimumAge) + "\n")
+	out.WriteString("Maximum number of days between password change\t\t: " + strconv.Itoa(a.MaximumAge) + "\n")
+	out.WriteString("Number of days of warning before password expires\t: " + strconv.Itoa(a.WarningDays) + "\n")
+	return out.String()
+}
+
+// Aging computes the dates on which the password and account of the
+// entry expire.
+func (se *ShadowEntry) Aging() Aging {
+	days := func(n int) time.Duration {
+		return time.Hour * 24 * time.Duration(n)
+	}
+	lastChanged := dayField(se.LastChanged, se.HasLastChanged)
+
+	a := Aging{
+		LastChanged:       se.LastChanged,
+		HasLastChanged:    lastChanged >= 0,
+		AccountExpires:    se.Expiration,
+		HasAccountExpires: dayField(se.Expiration, se.HasExpiration) >= 0,
+		MustChange:        se.ChangeForced(),
+		MinimumAge:        intField(se.MinimumPasswordAge, se.HasMinimumPasswordAge),
+		MaximumAge:        intField(se.MaximumPasswordAge, se.HasMaximumPasswordAge),
+		WarningDays:       intField(se.WarningDays, se.HasWarningDays),
+	}
+	if !a.HasLastChanged {
+		a.LastChanged = time.Time{}
+	}
+	if !a.HasAccountExpires {
+		a.AccountExpires = time.Time{}
+	}
+	if lastChanged <= 0 || a.MaximumAge < 0 || a.MaximumAge >= maxAgeInfinite {
+		return a
+	}
+
+	a.PasswordExpires = se.LastChanged.Add(days(a.MaximumAge))
+	a.HasPasswordExpires = true
+	if a.WarningDays > 0 {
+		a.WarningStarts = a.PasswordExpires.Add(-days(a.WarningDays))
+		a.HasWarningStarts = true
+	}
+	if inact := intField(se.InactivityDays, se.HasInactivityDays); inact >= 0 {
+		a.PasswordInactive = a.PasswordExpires.Add(days(inact))
+		a.HasPasswordInactive = true
+	}
+	return a
+}
+
+// ChangeForced reports if the password must be changed at the next
+// login, which is requested by setting the date of the last change to
+// the epoch as `passwd -e` does.
+func (se *ShadowEntry) ChangeForced() bool {
+	return se.HasLastChanged && se.LastChanged.Equal(epochStart)
+}
+
+// Expired checks the entry for expiry as of now, following the rules
+// of isexpired() in shadow-utils.
+func (se *ShadowEntry) Expired(now time.Time) ExpiryState {
+	today := dayNumber(now)
+	lastChanged := dayField(se.LastChanged, se.HasLastChanged)
+	expiration := dayField(se.Expiration, se.HasExpiration)
+	maxAge := intField(se.MaximumPasswordAge, se.HasMaximumPasswordAge)
+	inactive := intField(se.InactivityDays, se.HasInactivityDays)
+
+	if expiration > 0 && today >= expiration {
+		return ExpiryAccount
+	}
+
+	if lastChanged == 0 {
+		return ExpiryPassword
+	}
+
+	if lastChanged > 0 && maxAge >= 0 && inactive >= 0 &&
+		today >= lastChanged+maxAge+inactive {
+		return ExpiryInactive
+	}
+
+	if lastChanged < 0 || maxAge < 0 || maxAge >= maxAgeInfinite {
+		return ExpiryNone
+	}
+
+	if today >= lastChanged+maxAge {
+		return ExpiryPassword
+	}
+	return ExpiryNone
+}
+
+// LoginAllowed reports if the user may log in as of now.  This is
+// the case unless the account has expired or the password has been
+// expired for longer than the inactivity period.  A user whose
+// password has merely expired may log in, but must change it.
+func (se *ShadowEntry) LoginAllowed(now time.Time) bool {
+	return se.Expired(now) < ExpiryInactive
+}
+
+// InWarning reports if login(1) would warn about the upcoming expiry
+// of the password as of now.
+func (se *ShadowEntry) InWarning(now time.Time) bool {
+	if se.Expired(now) != ExpiryNone || !se.HasWarningDays {
+		return false
+	}
+	a := se.Aging()
+	return a.HasWarningStarts && !dayOf(now).Before(a.WarningStarts)
+}
+
+// intField returns the value of an optional numeric field, or -1 if
+// it is not set, which is how shadow-utils represents that.
+func intField(v int, has bool) int {
+	if !has {
+		return -1
+	}
+	return v
+}
+
+// dayField is intField for date fields.  Dates before the epoch,
+// such as those stored as -1, are treated as not set.
+func dayField(t time.Time, has bool) int {
+	if !has || t.Before(epochStart) {
+		return -1
+	}
+	return dayNumber(t)
+}
+
+// dayNumber returns the number of days between the epoch and t, which
+// is how dates are stored in the shadow database.
+func dayNumber(t time.Time) int {
+	return int(dayOf(t).Sub(epochStart).Hours() / 24)
+}
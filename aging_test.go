@@ -0,0 +1,97 @@
+package shadow
+
+import (
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestExpired(t *testing.T) {
+	// Day 18000 is 2019-04-14.
+	cases := []struct {
+		line      string
+		now       string
+		want      ExpiryState
+		allowed   bool
+		inWarning bool
+	}{
+		{"a:x:18000:0:99999:7:::", "2030-01-01", ExpiryNone, true, false},
+		{"a:x:18000:0:90:7:::", "2019-07-05", ExpiryNone, true, false},
+		{"a:x:18000:0:90:7:::", "2019-07-06", ExpiryNone, true, true},
+		{"a:x:18000:0:90:7:::", "2019-07-13", ExpiryPassword, true, false},
+		{"a:x:18000:0:90:7:10::", "2019-07-22", ExpiryPassword, true, false},
+		{"a:x:18000:0:90:7:10::", "2019-07-23", ExpiryInactive, false, false},
+		{"a:x:0:0:99999:7:::", "2019-01-01", ExpiryPassword, true, false},
+		{"a:x::0:90:7:::", "2030-01-01", ExpiryNone, true, false},
+		{"a:x:18000:0:::::", "2030-01-01", ExpiryNone, true, false},
+		{"a:x:18000:0:99999:7::18100:", "2019-07-22", ExpiryNone, true, false},
+		{"a:x:18000:0:99999:7::18100:", "2019-07-23", ExpiryAccount, false, false},
+		{"a:x:18000:0:99999:7::0:", "2030-01-01", ExpiryNone, true, false},
+	}
+
+	for i, c := range cases {
+		se := new(ShadowEntry)
+		if err := se.Parse(c.line); err != nil {
+			t.Fatal(err)
+		}
+		now := day(c.now).Add(13 * time.Hour)
+		if got := se.Expired(now); got != c.want {
+			t.Errorf("%d: Got %v; Want %v", i, got, c.want)
+		}
+		if got := se.LoginAllowed(now); got != c.allowed {
+			t.Errorf("%d: LoginAllowed: Got %v; Want %v", i, got, c.allowed)
+		}
+		if got := se.InWarning(now); got != c.inWarning {
+			t.Errorf("%d: InWarning: Got %v; Want %v", i, got, c.inWarning)
+		}
+	}
+}
+
+func TestAging(t *testing.T) {
+	se := new(ShadowEntry)
+	if err := se.Parse("maldridge:x:18000:1:90:7:10:18500:"); err != nil {
+		t.Fatal(err)
+	}
+	a := se.Aging()
+	if !a.HasPasswordExpires || !a.PasswordExpires.Equal(day("2019-07-13")) {
+		t.Errorf("PasswordExpires: Got %v", a.PasswordExpires)
+	}
+	if !a.HasWarningStarts || !a.WarningStarts.Equal(day("2019-07-06")) {
+		t.Errorf("WarningStarts: Got %v", a.WarningStarts)
+	}
+	if !a.HasPasswordInactive || !a.PasswordInactive.Equal(day("2019-07-23")) {
+		t.Errorf("PasswordInactive: Got %v", a.PasswordInactive)
+	}
+
+	want := "Last password change\t\t\t\t\t: Apr 14, 2019\n" +
+		"Password expires\t\t\t\t\t: Jul 13, 2019\n" +
+		"Password inactive\t\t\t\t\t: Jul 23, 2019\n" +
+		"Account expires\t\t\t\t\t\t: Aug 26, 2020\n" +
+		"Minimum number of days between password change\t\t: 1\n" +
+		"Maximum number of days between password change\t\t: 90\n" +
+		"Number of days of warning before password expires\t: 7\n"
+	if got := a.String(); got != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+	}
+
+	if err := se.Parse("maldridge:x:0::99999::::"); err != nil {
+		t.Fatal(err)
+	}
+	want = "Last password change\t\t\t\t\t: password must be changed\n" +
+		"Password expires\t\t\t\t\t: password must be changed\n" +
+		"Password inactive\t\t\t\t\t: password must be changed\n" +
+		"Account expires\t\t\t\t\t\t: never\n" +
+		"Minimum number of days between password change\t\t: -1\n" +
+		"Maximum number of days between password change\t\t: 99999\n" +
+		"Number of days of warning before password expires\t: -1\n"
+	if got := se.Aging().String(); got != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package shadow
+
+// An IDRange is an inclusive range of UIDs or GIDs.
+type IDRange struct {
+	Min int
+	Max int
+}
+
+// Contains reports if id falls within the range.
+func (r IDRange) Contains(id int) bool {
+	return id >= r.Min && id <= r.Max
+}
+
+// Overlaps reports if any ID is covered by both r and o.
+func (r IDRange) Overlaps(o IDRange) bool {
+	return r.Min <= o.Max && o.Min <= r.Max
+}
+
+// An Allocator hands out free UIDs and GIDs.  The ranges correspond
+// to UID_MIN/UID_MAX, SYS_UID_MIN/SYS_UID_MAX and their GID
+// equivalents in login.defs(5).
+type Allocator struct {
+	UID    IDRange
+	SysUID IDRange
+	GID    IDRange
+	SysGID IDRange
+
+	// Reserved lists ranges that must never be handed out, for
+	// example because they are in use as subordinate IDs.
+	Reserved []IDRange
+}
+
+// DefaultAllocator returns an Allocator with the ranges that
+// shadow-utils uses when login.defs does not set them.
+func DefaultAllocator() *Allocator {
+	return &Allocator{
+		UID:    IDRange{Min: 1000, Max: 60000},
+		SysUID: IDRange{Min: 101, Max: 999},
+		GID:    IDRange{Min: 1000, Max: 60000},
+		SysGID: IDRange{Min: 101, Max: 999},
+	}
+}
+
+// NextUID returns a UID that is not used in pm.  The choice follows
+// useradd(8): regular users get one more than the highest UID in use
+// in the regular range, and system users get one less than the lowest
+// UID in use in the system range.  If that falls outside the range,
+// the range is searched for a gap.
+func (a *Allocator) NextUID(pm *PasswdMap, system bool) (int, error) {
+	r := a.UID
+	if system {
+		r = a.SysUID
+	}
+	return a.next(r, system, usedUIDs(pm))
+}
+
+// NextGID is NextUID for groups.
+func (a *Allocator) NextGID(gm *GroupMap, system bool) (int, error) {
+	r := a.GID
+	if system {
+		r = a.SysGID
+	}
+	return a.next(r, system, usedGIDs(gm))
+}
+
+// NextUIDGID returns an ID that is free both as a UID in pm and as a
+// GID in gm, so that a user and their private group can share it.
+// ErrNoFreeID is returned if there is no such ID, in which case the
+// caller should fall back to NextUID and NextGID.
+func (a *Allocator) NextUIDGID(pm *PasswdMap, gm *GroupMap, system bool) (int, error) {
+	r := a.UID
+	gr := a.GID
+	if system {
+		r = a.SysUID
+		gr = a.SysGID
+	}
+	if gr.Min > r.Min {
+		r.Min = gr.Min
+	}
+	if gr.Max < r.Max {
+		r.Max = gr.Max
+	}
+
+	used := usedUIDs(pm)
+	for id := range usedGIDs(gm) {
+		used[id] = true
+	}
+	return a.next(r, system, used)
+}
+
+func (a *Allocator) next(r IDRange, system bool, used map[int]bool) (int, error) {
+	free := func(id int) bool {
+		if used[id] || !r.Contains(id) {
+			return false
+		}
+		for _, res := range a.Reserved {
+			if res.Contains(id) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if r.Min > r.Max {
+		return 0, ErrNoFreeID
+	}
+
+	if system {
+		lowest := r.Max + 1
+		for id := range used {
+			if r.Contains(id) && id < lowest {
+				lowest = id
+			}
+		}
+		if free(lowest - 1) {
+			return lowest - 1, nil
+		}
+		for id := r.Max; id >= r.Min; id-- {
+			if free(id) {
+				return id, nil
+			}
+		}
+		return 0, ErrNoFreeID
+	}
+
+	highest := r.Min - 1
+	for id := range used {
+		if r.Contains(id) && id > highest {
+			highest = id
+		}
+	}
+	if free(highest + 1) {
+		return highest + 1, nil
+	}
+	for id := r.Min; id <= r.Max; id++ {
+		if free(id) {
+			return id, nil
+		}
+	}
+	return 0, ErrNoFreeID
+}
+
+func usedUIDs(pm *PasswdMap) map[int]bool {
+	used := make(map[int]bool)
+	if pm == nil {
+		return used
+	}
+	for _, l := range pm.lines {
+		if l.Compat() != CompatNone {
+			continue
+		}
+		used[l.UID] = true
+	}
+	return used
+}
+
+func usedGIDs(gm *GroupMap) map[int]bool {
+	used := make(map[int]bool)
+	if gm == nil {
+		return used
+	}
+	for _, l := range gm.lines {
+		if l.Compat() != CompatNone {
+			continue
+		}
+		used[l.GID] = true
+	}
+	return used
+}
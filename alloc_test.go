@@ -0,0 +1,90 @@
+package shadow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNextUID(t *testing.T) {
+	pm, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"daemon:x:998:998::/:/sbin/nologin\n" +
+			"a:x:1000:1000::/home/a:/bin/sh\n" +
+			"b:x:1005:1005::/home/b:/bin/sh\n" +
+			"full:x:1010:1010::/home/full:/bin/sh\n"))
+
+	cases := []struct {
+		a       *Allocator
+		system  bool
+		want    int
+		wantErr error
+	}{
+		{
+			a:      DefaultAllocator(),
+			system: false,
+			want:   1011,
+		},
+		{
+			a:      DefaultAllocator(),
+			system: true,
+			want:   997,
+		},
+		{
+			// The top of the range is taken, so the first
+			// gap is used.
+			a: &Allocator{
+				UID: IDRange{Min: 1000, Max: 1010},
+			},
+			want: 1001,
+		},
+		{
+			a: &Allocator{
+				UID:      IDRange{Min: 1011, Max: 1020},
+				Reserved: []IDRange{{Min: 1011, Max: 1015}},
+			},
+			want: 1016,
+		},
+		{
+			a: &Allocator{
+				UID: IDRange{Min: 1000, Max: 1000},
+			},
+			wantErr: ErrNoFreeID,
+		},
+	}
+
+	for i, c := range cases {
+		got, err := c.a.NextUID(pm, c.system)
+		if err != c.wantErr {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("%d: Got %d; Want %d", i, got, c.want)
+		}
+	}
+}
+
+func TestNextUIDGID(t *testing.T) {
+	pm, _ := ParsePasswdMap(strings.NewReader(
+		"a:x:1000:1000::/home/a:/bin/sh\n"))
+	gm, _ := ParseGroupMap(strings.NewReader(
+		"a:x:1000:\n" +
+			"shared:x:1001:\n"))
+
+	a := DefaultAllocator()
+	id, err := a.NextUIDGID(pm, gm, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1002 {
+		t.Errorf("Got %d; Want 1002", id)
+	}
+
+	uid, err := a.NextUID(pm, false)
+	if err != nil || uid != 1001 {
+		t.Errorf("Got %d, %v; Want 1001", uid, err)
+	}
+	gid, err := a.NextGID(gm, false)
+	if err != nil || gid != 1002 {
+		t.Errorf("Got %d, %v; Want 1002", gid, err)
+	}
+}
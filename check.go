@@ -0,0 +1,374 @@
+package shadow
+
+import (
+	"fmt"
+)
+
+// Severity describes how serious a Finding is.
+type Severity int
+
+// The severities mirror the distinction pwck(8) makes between
+// problems it will only warn about and those that it considers
+// errors.
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// These are the rules that Check evaluates.
+const (
+	RuleDuplicateLogin     = "duplicate-login"
+	RuleDuplicateUID       = "duplicate-uid"
+	RuleMissingShadow      = "missing-shadow"
+	RuleOrphanShadow       = "orphan-shadow"
+	RuleNotShadowed        = "not-shadowed"
+	RuleUnknownGroup       = "unknown-primary-group"
+	RuleDuplicateGroup     = "duplicate-group"
+	RuleDuplicateGID       = "duplicate-gid"
+	RuleUnknownGroupMember = "unknown-group-member"
+)
+
+// A Finding is a single problem discovered by Check.
+type Finding struct {
+	Severity Severity
+
+	// File is the database the problem was found in, and Line
+	// is the 1-based line of the offending entry within it.
+	File string
+	Line int
+
+	// Entry is the login or group name of the offending entry.
+	Entry   string
+	Rule    string
+	Message string
+
+	// Fixed is set by Repair on findings that it corrected.
+	Fixed bool
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s (%s)", f.File, f.Line, f.Severity, f.Message, f.Rule)
+}
+
+// Check examines the passwd, shadow and group databases for the
+// problems that pwck(8) and grpck(8) report.  Any of the maps may be
+// nil, in which case the checks that need it are skipped.  Findings
+// are returned in the order the offending entries appear, passwd
+// first, then shadow, then group.  NIS compat entries are not
+// checked.
+func Check(pm *PasswdMap, sm *ShadowMap, gm *GroupMap) []Finding {
+	out := []Finding{}
+
+	logins := make(map[string]bool)
+	if pm != nil {
+		for _, l := range pm.lines {
+			if l.Compat() != CompatNone {
+				continue
+			}
+			logins[l.Login] = true
+		}
+	}
+	groups := make(map[int]bool)
+	if gm != nil {
+		for _, l := range gm.lines {
+			if l.Compat() != CompatNone {
+				continue
+			}
+			groups[l.GID] = true
+		}
+	}
+	shadowed := make(map[string]bool)
+	if sm != nil {
+		for _, l := range sm.lines {
+			shadowed[l.Login] = true
+		}
+	}
+
+	if pm != nil {
+		seenLogin := make(map[string]bool)
+		seenUID := make(map[int]string)
+		n := 0
+		for _, l := range pm.lines {
+			line := pm.raw.line(&n, l)
+			if l.Compat() != CompatNone {
+				continue
+			}
+			add := func(sev Severity, rule, msg string, args ...interface{}) {
+				out = append(out, Finding{
+					Severity: sev,
+					File:     "passwd",
+					Line:     line,
+					Entry:    l.Login,
+					Rule:     rule,
+					Message:  fmt.Sprintf(msg, args...),
+				})
+			}
+
+			if seenLogin[l.Login] {
+				add(SeverityError, RuleDuplicateLogin, "duplicate password entry for %s", l.Login)
+				continue
+			}
+			seenLogin[l.Login] = true
+
+			if other, ok := seenUID[l.UID]; ok {
+				add(SeverityWarning, RuleDuplicateUID, "user %s has the same UID %d as %s", l.Login, l.UID, other)
+			} else {
+				seenUID[l.UID] = l.Login
+			}
+			if gm != nil && !groups[l.GID] {
+				add(SeverityWarning, RuleUnknownGroup, "user %s: no group %d", l.Login, l.GID)
+			}
+			if sm != nil && !shadowed[l.Login] {
+				add(SeverityError, RuleMissingShadow, "no matching password file entry in shadow for %s", l.Login)
+			}
+			if sm != nil && shadowed[l.Login] && l.Password != "x" {
+				add(SeverityWarning, RuleNotShadowed, "user %s has an entry in shadow, but its password field in passwd is not set to 'x'", l.Login)
+			}
+		}
+	}
+
+	if sm != nil {
+		seen := make(map[string]bool)
+		n := 0
+		for _, l := range sm.lines {
+			line := sm.raw.line(&n, l)
+			if compatKind(l.Login) != CompatNone {
+				continue
+			}
+			add := func(sev Severity, rule, msg string, args ...interface{}) {
+				out = append(out, Finding{
+					Severity: sev,
+					File:     "shadow",
+					Line:     line,
+					Entry:    l.Login,
+					Rule:     rule,
+					Message:  fmt.Sprintf(msg, args...),
+				})
+			}
+
+			if seen[l.Login] {
+				add(SeverityError, RuleDuplicateLogin, "duplicate shadow password entry for %s", l.Login)
+				continue
+			}
+			seen[l.Login] = true
+
+			if pm != nil && !logins[l.Login] {
+				add(SeverityError, RuleOrphanShadow, "no matching password file entry in passwd for %s", l.Login)
+			}
+		}
+	}
+
+	if gm != nil {
+		seenName := make(map[string]bool)
+		seenGID := make(map[int]string)
+		n := 0
+		for _, l := range gm.lines {
+			line := gm.raw.line(&n, l)
+			if l.Compat() != CompatNone {
+				continue
+			}
+			add := func(sev Severity, rule, msg string, args ...interface{}) {
+				out = append(out, Finding{
+					Severity: sev,
+					File:     "group",
+					Line:     line,
+					Entry:    l.Name,
+					Rule:     rule,
+					Message:  fmt.Sprintf(msg, args...),
+				})
+			}
+
+			if seenName[l.Name] {
+				add(SeverityError, RuleDuplicateGroup, "duplicate group entry for %s", l.Name)
+				continue
+			}
+			seenName[l.Name] = true
+
+			if other, ok := seenGID[l.GID]; ok {
+				add(SeverityWarning, RuleDuplicateGID, "group %s has the same GID %d as %s", l.Name, l.GID, other)
+			} else {
+				seenGID[l.GID] = l.Name
+			}
+			if pm != nil {
+				for _, m := range l.UserList {
+					if !logins[m] {
+						add(SeverityWarning, RuleUnknownGroupMember, "group %s: no user %s", l.Name, m)
+					}
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// Repair runs Check and then returns corrected copies of the maps.
+// The maps passed in are not modified.  Duplicate entries are
+// dropped keeping the first, shadow entries without a passwd entry
+// are removed, users without a shadow entry get one in the same way
+// pwconv(8) would create it, and unknown users are removed from
+// group member lists.  Problems that need a human to decide, such as
+// duplicate IDs, are left alone.  The returned findings are those of
+// the original maps, with Fixed set on the ones that were corrected.
+func Repair(pm *PasswdMap, sm *ShadowMap, gm *GroupMap) (*PasswdMap, *ShadowMap, *GroupMap, []Finding) {
+	findings := Check(pm, sm, gm)
+	pm, sm, gm = pm.clone(), sm.clone(), gm.clone()
+
+	type key struct {
+		file string
+		line int
+	}
+	drop := make(map[key]bool)
+	for i, f := range findings {
+		switch f.Rule {
+		case RuleDuplicateLogin, RuleOrphanShadow, RuleDuplicateGroup:
+			drop[key{f.File, f.Line}] = true
+			findings[i].Fixed = true
+		}
+	}
+
+	if pm != nil {
+		out := []*PasswdEntry{}
+		n := 0
+		for _, l := range pm.lines {
+			if drop[key{"passwd", pm.raw.line(&n, l)}] {
+				pm.raw.drop(l)
+				continue
+			}
+			pm.raw.keep(l)
+			out = append(out, l)
+		}
+		pm.raw.flush()
+		pm.lines = out
+	}
+
+	if sm != nil {
+		out := []*ShadowEntry{}
+		n := 0
+		for _, l := range sm.lines {
+			if drop[key{"shadow", sm.raw.line(&n, l)}] {
+				sm.raw.drop(l)
+				continue
+			}
+			sm.raw.keep(l)
+			out = append(out, l)
+		}
+		sm.raw.flush()
+		sm.lines = out
+	}
+
+	if gm != nil {
+		out := []*GroupEntry{}
+		n := 0
+		for _, l := range gm.lines {
+			if drop[key{"group", gm.raw.line(&n, l)}] {
+				gm.raw.drop(l)
+				continue
+			}
+			gm.raw.keep(l)
+			out = append(out, l)
+		}
+		gm.raw.flush()
+		gm.lines = out
+	}
+
+	pruneMembers := false
+	for i, f := range findings {
+		switch f.Rule {
+		case RuleMissingShadow:
+			for _, l := range pm.lines {
+				if l.Login != f.Entry {
+					continue
+				}
+				se := &ShadowEntry{Login: l.Login, Password: l.Password}
+				if se.Password == "x" {
+					se.Password = "!"
+				}
+				l.Password = "x"
+				sm.Add([]*ShadowEntry{se})
+				break
+			}
+			findings[i].Fixed = true
+		case RuleUnknownGroupMember:
+			pruneMembers = true
+			findings[i].Fixed = true
+		}
+	}
+
+	if pruneMembers {
+		logins := make(map[string]bool, len(pm.lines))
+		for _, l := range pm.lines {
+			if l.Compat() != CompatNone {
+				continue
+			}
+			logins[l.Login] = true
+		}
+		for _, l := range gm.lines {
+			members := []string{}
+			for _, m := range l.UserList {
+				if logins[m] {
+					members = append(members, m)
+				}
+			}
+			l.UserList = members
+		}
+	}
+
+	return pm, sm, gm, findings
+}
+
+// clone returns a copy of the map whose entries can be modified
+// without affecting the original.
+func (pm *PasswdMap) clone() *PasswdMap {
+	if pm == nil {
+		return nil
+	}
+	out := &PasswdMap{lines: make([]*PasswdEntry, len(pm.lines))}
+	for i, l := range pm.lines {
+		e := *l
+		out.lines[i] = &e
+		out.raw.copyFrom(&pm.raw, l, &e)
+	}
+	out.raw.copyTail(&pm.raw)
+	return out
+}
+
+func (sm *ShadowMap) clone() *ShadowMap {
+	if sm == nil {
+		return nil
+	}
+	out := &ShadowMap{lines: make([]*ShadowEntry, len(sm.lines))}
+	for i, l := range sm.lines {
+		e := *l
+		out.lines[i] = &e
+		out.raw.copyFrom(&sm.raw, l, &e)
+	}
+	out.raw.copyTail(&sm.raw)
+	return out
+}
+
+func (gm *GroupMap) clone() *GroupMap {
+	if gm == nil {
+		return nil
+	}
+	out := &GroupMap{lines: make([]*GroupEntry, len(gm.lines))}
+	for i, l := range gm.lines {
+		e := *l
+		e.UserList = append([]string(nil), l.UserList...)
+		out.lines[i] = &e
+		out.raw.copyFrom(&gm.raw, l, &e)
+	}
+	out.raw.copyTail(&gm.raw)
+	return out
+}
@@ -0,0 +1,105 @@
+package shadow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	pm, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"foo:x:1000:1000::/home/foo:/bin/sh\n" +
+			"bar:x:1000:1001::/home/bar:/bin/sh\n" +
+			"foo:x:1002:1000::/home/foo:/bin/sh\n"))
+	sm, _ := ParseShadowMap(strings.NewReader(
+		"root:*:17518:0:99999:7:::\n" +
+			"foo:!:17518:0:99999:7:::\n" +
+			"ghost:!:17518:0:99999:7:::\n"))
+	gm, _ := ParseGroupMap(strings.NewReader(
+		"root:x:0:\n" +
+			"foo:x:1000:bar,nobody\n"))
+
+	want := []struct {
+		file string
+		line int
+		rule string
+	}{
+		{"passwd", 3, RuleDuplicateUID},
+		{"passwd", 3, RuleUnknownGroup},
+		{"passwd", 3, RuleMissingShadow},
+		{"passwd", 4, RuleDuplicateLogin},
+		{"shadow", 3, RuleOrphanShadow},
+		{"group", 2, RuleUnknownGroupMember},
+	}
+
+	got := Check(pm, sm, gm)
+	if len(got) != len(want) {
+		t.Fatalf("Got %d findings; Want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].File != w.file || got[i].Line != w.line || got[i].Rule != w.rule {
+			t.Errorf("%d: Got %v; Want %s:%d %s", i, got[i], w.file, w.line, w.rule)
+		}
+	}
+}
+
+func TestCheckLineNumbers(t *testing.T) {
+	pm, _ := ParsePasswdMap(strings.NewReader(
+		"# system\n" +
+			"root:x:0:0:root:/root:/bin/sh\n" +
+			"\n" +
+			"# people\n" +
+			"root:x:0:0:root:/root:/bin/sh\n"))
+
+	got := Check(pm, nil, nil)
+	if len(got) != 1 || got[0].Line != 5 || got[0].Rule != RuleDuplicateLogin {
+		t.Fatalf("Got %v", got)
+	}
+
+	npm, _, _, _ := Repair(pm, nil, nil)
+	want := "# system\nroot:x:0:0:root:/root:/bin/sh\n\n# people\n"
+	if npm.String() != want {
+		t.Errorf("Got %q; Want %q", npm.String(), want)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	pm, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"foo:secret:1000:1000::/home/foo:/bin/sh\n" +
+			"root:x:0:0:root:/root:/bin/sh\n"))
+	sm, _ := ParseShadowMap(strings.NewReader(
+		"root:*:17518:0:99999:7:::\n" +
+			"ghost:!:17518:0:99999:7:::\n"))
+	gm, _ := ParseGroupMap(strings.NewReader(
+		"root:x:0:\n" +
+			"foo:x:1000:foo,nobody\n"))
+
+	npm, nsm, ngm, findings := Repair(pm, sm, gm)
+	for _, f := range findings {
+		if !f.Fixed {
+			t.Errorf("Not fixed: %v", f)
+		}
+	}
+	if left := Check(npm, nsm, ngm); len(left) != 0 {
+		t.Errorf("Findings remain after repair: %v", left)
+	}
+
+	wantP := "root:x:0:0:root:/root:/bin/sh\nfoo:x:1000:1000::/home/foo:/bin/sh\n"
+	if npm.String() != wantP {
+		t.Errorf("Got '%s'; Want '%s'", npm.String(), wantP)
+	}
+	wantS := "root:*:17518:0:99999:7:::\nfoo:secret:::::::\n"
+	if nsm.String() != wantS {
+		t.Errorf("Got '%s'; Want '%s'", nsm.String(), wantS)
+	}
+	wantG := "root:x:0:\nfoo:x:1000:foo\n"
+	if ngm.String() != wantG {
+		t.Errorf("Got '%s'; Want '%s'", ngm.String(), wantG)
+	}
+
+	// The originals must be untouched.
+	if len(pm.lines) != 3 || pm.lines[1].Password != "secret" {
+		t.Error("Repair modified its input")
+	}
+}
@@ -0,0 +1,111 @@
+package shadow
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A CompatKind identifies the NIS compat entries that nsswitch's
+// "compat" service understands in passwd and group.  The name of a
+// compat entry keeps its leading "+" or "-", so that it can never be
+// mistaken for a local user or group, and is followed by the user or
+// group it applies to, "@" and a netgroup, or nothing to stand for
+// every entry in NIS.  The remaining fields of an inclusion override
+// the values from NIS where they are not empty.
+type CompatKind int
+
+// An entry that does not start with "+" or "-" is an ordinary entry
+// of kind CompatNone.
+const (
+	CompatNone CompatKind = iota
+	CompatInclude
+	CompatExclude
+)
+
+func (k CompatKind) String() string {
+	switch k {
+	case CompatNone:
+		return "none"
+	case CompatInclude:
+		return "include"
+	case CompatExclude:
+		return "exclude"
+	default:
+		return "unknown"
+	}
+}
+
+// compatKind returns the kind of the entry with the given name.
+func compatKind(name string) CompatKind {
+	switch {
+	case len(name) == 0:
+		return CompatNone
+	case name[0] == '+':
+		return CompatInclude
+	case name[0] == '-':
+		return CompatExclude
+	default:
+		return CompatNone
+	}
+}
+
+// Compat returns the kind of NIS compat entry pe is.
+func (pe *PasswdEntry) Compat() CompatKind {
+	return compatKind(pe.Login)
+}
+
+// Compat returns the kind of NIS compat entry ge is.
+func (ge *GroupEntry) Compat() CompatKind {
+	return compatKind(ge.Name)
+}
+
+// CompatName returns the user, "@" followed by a netgroup, or the
+// empty string for every user, that a compat entry applies to.
+func (pe *PasswdEntry) CompatName() string {
+	if pe.Compat() == CompatNone {
+		return ""
+	}
+	return pe.Login[1:]
+}
+
+// CompatName returns the group, or the empty string for every group,
+// that a compat entry applies to.
+func (ge *GroupEntry) CompatName() string {
+	if ge.Compat() == CompatNone {
+		return ""
+	}
+	return ge.Name[1:]
+}
+
+// compatFields splits a compat entry into n fields.  Trailing fields
+// may be left out, as they often are in "-user" and "+".
+func compatFields(s string, n int) ([]string, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) > n {
+		return nil, recordError(ErrWrongNumFields)
+	}
+	for len(fields) < n {
+		fields = append(fields, "")
+	}
+	return fields, nil
+}
+
+// optInt parses an optional numeric override of a compat entry.
+func optInt(s string) (int, bool, error) {
+	if s == "" {
+		return 0, false, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false, err
+	}
+	return v, true, nil
+}
+
+// optItoa formats an optional numeric override of a compat entry.
+func optItoa(v int, has bool) string {
+	if !has {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
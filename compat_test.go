@@ -0,0 +1,110 @@
+package shadow
+
+import (
+	"strings"
+	"testing"
+)
+
+const compatPasswd = `root:x:0:0:root:/root:/bin/sh
+maldridge:x:1000:1000::/home/maldridge:/bin/sh
+-baduser
++@admins::::::/bin/bash
++guest::2000:100:::/bin/false
++::::::
+`
+
+func TestParseCompatPasswd(t *testing.T) {
+	pm, err := ParsePasswdMap(strings.NewReader(compatPasswd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pm.lines) != 6 {
+		t.Fatalf("Got %d entries; Want 6", len(pm.lines))
+	}
+	if pm.String() != compatPasswd {
+		t.Errorf("Got:\n%s\nWant:\n%s", pm, compatPasswd)
+	}
+
+	cases := []struct {
+		kind   CompatKind
+		name   string
+		shell  string
+		hasUID bool
+	}{
+		{CompatNone, "", "/bin/sh", false},
+		{CompatNone, "", "/bin/sh", false},
+		{CompatExclude, "baduser", "", false},
+		{CompatInclude, "@admins", "/bin/bash", false},
+		{CompatInclude, "guest", "/bin/false", true},
+		{CompatInclude, "", "", false},
+	}
+	for i, c := range cases {
+		l := pm.lines[i]
+		if l.Compat() != c.kind || l.CompatName() != c.name || l.Shell != c.shell || l.HasUID != c.hasUID {
+			t.Errorf("%d: Got %v %q %+v", i, l.Compat(), l.CompatName(), l)
+		}
+	}
+
+	if got := pm.FilterUID(func(int) bool { return true }); len(got) != 2 {
+		t.Errorf("Got %d entries; Want 2", len(got))
+	}
+	got := pm.FilterUID(func(uid int) bool { return uid >= 1000 }, IncludeCompat())
+	if len(got) != 2 || got[1].Login != "+guest" {
+		t.Errorf("Got %v", got)
+	}
+}
+
+func TestCompatPasswdString(t *testing.T) {
+	cases := []struct {
+		pe   PasswdEntry
+		want string
+	}{
+		{PasswdEntry{Login: "+"}, "+"},
+		{PasswdEntry{Login: "-@banned"}, "-@banned"},
+		{PasswdEntry{Login: "+user", Shell: "/bin/false"}, "+user::::::/bin/false"},
+		{PasswdEntry{Login: "+user", UID: 0, HasUID: true}, "+user::0::::"},
+	}
+	for i, c := range cases {
+		if c.pe.String() != c.want {
+			t.Errorf("%d: Got %s; Want %s", i, c.pe.String(), c.want)
+		}
+	}
+
+	pe := new(PasswdEntry)
+	if err := pe.Parse("+user:x:1:2:3:4:5:6"); err == nil {
+		t.Error("Parsed a compat entry with too many fields")
+	}
+	if err := pe.Parse("+user::abc::::"); err == nil {
+		t.Error("Parsed a compat entry with a bad UID")
+	}
+}
+
+func TestParseCompatGroup(t *testing.T) {
+	in := "wheel:x:10:maldridge\n+admins:::extra\n-games\n+\n"
+	gm, err := ParseGroupMap(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gm.String() != in {
+		t.Errorf("Got:\n%s\nWant:\n%s", gm, in)
+	}
+	if k := gm.lines[1].Compat(); k != CompatInclude || gm.lines[1].UserList[0] != "extra" {
+		t.Errorf("Got %v %+v", k, gm.lines[1])
+	}
+	if k := gm.lines[2].Compat(); k != CompatExclude || gm.lines[2].CompatName() != "games" {
+		t.Errorf("Got %v %+v", k, gm.lines[2])
+	}
+	if got := gm.FilterGID(func(gid int) bool { return gid == 0 }, IncludeCompat()); len(got) != 0 {
+		t.Errorf("Got %v", got)
+	}
+}
+
+func TestCheckCompat(t *testing.T) {
+	pm, _ := ParsePasswdMap(strings.NewReader(compatPasswd))
+	sm, _ := ParseShadowMap(strings.NewReader("root:*:17518:0:99999:7:::\nmaldridge:!:17518:0:99999:7:::\n+::::::::\n"))
+	gm, _ := ParseGroupMap(strings.NewReader("root:x:0:\nmaldridge:x:1000:\n+\n"))
+
+	if got := Check(pm, sm, gm); len(got) != 0 {
+		t.Errorf("Got %v", got)
+	}
+}
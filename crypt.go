@@ -0,0 +1,144 @@
+package shadow
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the password hashing methods that are supported.  The
+// names are the same as those used for ENCRYPT_METHOD in login.defs.
+const (
+	MethodSHA256   = "SHA256"
+	MethodSHA512   = "SHA512"
+	MethodBcrypt   = "BCRYPT"
+	MethodYescrypt = "YESCRYPT"
+)
+
+// cryptAlphabet is the base64 alphabet used by crypt(3).  It is not
+// the same as the one used by encoding/base64.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Crypt hashes key with the method and parameters in setting in the
+// same way as crypt(3).  The setting may be just the prefix, such as
+// "$6$rounds=10000$saltsalt", or a complete hash, in which case the
+// hash part is ignored.  This makes it possible to check a password
+// by comparing Crypt(password, hash) with hash.
+func Crypt(key, setting string) (string, error) {
+	switch {
+	case strings.HasPrefix(setting, "$5$"):
+		return shaCrypt(sha256Crypt, key, setting)
+	case strings.HasPrefix(setting, "$6$"):
+		return shaCrypt(sha512Crypt, key, setting)
+	case strings.HasPrefix(setting, "$2b$"),
+		strings.HasPrefix(setting, "$2a$"),
+		strings.HasPrefix(setting, "$2y$"):
+		return bcryptCrypt(key, setting)
+	case strings.HasPrefix(setting, "$y$"):
+		return yescryptCrypt(key, setting)
+	default:
+		return "", ErrUnsupportedHash
+	}
+}
+
+// GenSalt returns a new setting for Crypt with a random salt.  The
+// meaning of rounds depends on the method: it is the number of rounds
+// for SHA256 and SHA512, the base 2 logarithm of the number of rounds
+// for BCRYPT, and the cost factor between 1 and 11 for YESCRYPT, as
+// in the *_ROUNDS and YESCRYPT_COST_FACTOR settings of login.defs.
+// A rounds value of 0 selects the default for the method.
+func GenSalt(method string, rounds int) (string, error) {
+	switch strings.ToUpper(method) {
+	case MethodSHA256:
+		return shaGenSalt(sha256Crypt, rounds)
+	case MethodSHA512:
+		return shaGenSalt(sha512Crypt, rounds)
+	case MethodBcrypt:
+		return bcryptGenSalt(rounds)
+	case MethodYescrypt:
+		return yescryptGenSalt(rounds)
+	default:
+		return "", ErrUnsupportedHash
+	}
+}
+
+// SetPassword hashes plaintext with the given method and rounds, as
+// described for GenSalt, and stores it as the entry's password.  The
+// date of the last password change is set to today.
+func (se *ShadowEntry) SetPassword(plaintext, method string, rounds int) error {
+	setting, err := GenSalt(method, rounds)
+	if err != nil {
+		return err
+	}
+	hash, err := Crypt(plaintext, setting)
+	if err != nil {
+		return err
+	}
+	se.Password = hash
+	se.LastChanged = dayOf(time.Now())
+	se.HasLastChanged = true
+	return nil
+}
+
+// VerifyPassword reports if plaintext is the password of the entry.
+// Entries without a usable password hash, including locked entries
+// and those with an empty password, never match.
+func (se *ShadowEntry) VerifyPassword(plaintext string) bool {
+	if !strings.HasPrefix(se.Password, "$") {
+		return false
+	}
+	hash, err := Crypt(plaintext, se.Password)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(se.Password)) == 1
+}
+
+// randomSalt returns n random characters from cryptAlphabet.
+func randomSalt(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = cryptAlphabet[b[i]&0x3f]
+	}
+	return string(b), nil
+}
+
+// atoi64 returns the value of a character in cryptAlphabet, or -1 if
+// it is not part of it.
+func atoi64(c byte) int {
+	return strings.IndexByte(cryptAlphabet, c)
+}
+
+// cutSetting splits the salt from the part of a setting after the
+// method prefix.  The salt ends at the next '$' or the end of the
+// string.
+func cutSetting(s string) string {
+	if i := strings.IndexByte(s, '$'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// parseRounds reads an optional "rounds=N$" parameter from the start
+// of s, returning the value, whether it was present, and the rest of
+// s.
+func parseRounds(s string) (int, bool, string, error) {
+	if !strings.HasPrefix(s, "rounds=") {
+		return 0, false, s, nil
+	}
+	s = strings.TrimPrefix(s, "rounds=")
+	i := strings.IndexByte(s, '$')
+	if i < 0 {
+		return 0, false, "", ErrInvalidHash
+	}
+	n, err := strconv.ParseUint(s[:i], 10, 32)
+	if err != nil {
+		return 0, false, "", ErrInvalidHash
+	}
+	return int(n), true, s[i+1:], nil
+}
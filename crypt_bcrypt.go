@@ -0,0 +1,214 @@
+package shadow
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+const (
+	bcryptDefaultCost = 10
+	bcryptMinCost     = 4
+	bcryptMaxCost     = 31
+	bcryptSaltLen     = 16
+	bcryptMaxKey      = 72
+)
+
+// bcryptAlphabet is the base64 alphabet used by bcrypt, which is
+// different again from the one used by crypt(3).
+const bcryptAlphabet = "./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// bcryptMagic is the plaintext that bcrypt encrypts.
+var bcryptMagic = []byte("OrpheanBeholderScryDoubt")
+
+func bcryptGenSalt(cost int) (string, error) {
+	if cost == 0 {
+		cost = bcryptDefaultCost
+	}
+	if cost < bcryptMinCost || cost > bcryptMaxCost {
+		return "", ErrInvalidHash
+	}
+	salt := make([]byte, bcryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return "$2b$" + bcryptCostString(cost) + "$" + bcryptEncode(salt), nil
+}
+
+func bcryptCrypt(key, setting string) (string, error) {
+	prefix := setting[:4]
+	rest := setting[4:]
+	if len(rest) < 3+22 || rest[2] != '$' {
+		return "", ErrInvalidHash
+	}
+	cost, err := strconv.Atoi(rest[:2])
+	if err != nil || cost < bcryptMinCost || cost > bcryptMaxCost {
+		return "", ErrInvalidHash
+	}
+	salt, ok := bcryptDecode(rest[3:3+22], bcryptSaltLen)
+	if !ok {
+		return "", ErrInvalidHash
+	}
+
+	// The key includes its terminating NUL, as it would in C.
+	k := append([]byte(key), 0)
+	if len(k) > bcryptMaxKey {
+		k = k[:bcryptMaxKey]
+	}
+
+	bf := newEksBlowfish(cost, salt, k)
+
+	ctext := make([]uint32, len(bcryptMagic)/4)
+	for i := range ctext {
+		ctext[i] = binary.BigEndian.Uint32(bcryptMagic[i*4:])
+	}
+	for i := 0; i < 64; i++ {
+		for j := 0; j < len(ctext); j += 2 {
+			ctext[j], ctext[j+1] = bf.encrypt(ctext[j], ctext[j+1])
+		}
+	}
+	out := make([]byte, len(bcryptMagic))
+	for i, w := range ctext {
+		binary.BigEndian.PutUint32(out[i*4:], w)
+	}
+
+	// Only 23 of the 24 bytes are used, which is a long standing
+	// quirk of the original implementation.
+	return prefix + bcryptCostString(cost) + "$" + bcryptEncode(salt) + bcryptEncode(out[:23]), nil
+}
+
+func bcryptCostString(cost int) string {
+	if cost < 10 {
+		return "0" + strconv.Itoa(cost)
+	}
+	return strconv.Itoa(cost)
+}
+
+// bcryptEncode encodes b in the bcrypt flavor of base64, which is
+// ordinary base64 without padding but with a different alphabet.
+func bcryptEncode(b []byte) string {
+	out := new(strings.Builder)
+	for len(b) > 0 {
+		var w uint
+		n := len(b)
+		if n > 3 {
+			n = 3
+		}
+		for i := 0; i < 3; i++ {
+			w <<= 8
+			if i < n {
+				w |= uint(b[i])
+			}
+		}
+		for i := 0; i < n+1; i++ {
+			out.WriteByte(bcryptAlphabet[(w>>uint(18-6*i))&0x3f])
+		}
+		b = b[n:]
+	}
+	return out.String()
+}
+
+// bcryptDecode reverses bcryptEncode, producing exactly n bytes.
+func bcryptDecode(s string, n int) ([]byte, bool) {
+	out := make([]byte, 0, n+2)
+	for len(s) > 0 && len(out) < n {
+		var w uint
+		chars := len(s)
+		if chars > 4 {
+			chars = 4
+		}
+		if chars < 2 {
+			return nil, false
+		}
+		for i := 0; i < 4; i++ {
+			w <<= 6
+			if i < chars {
+				c := strings.IndexByte(bcryptAlphabet, s[i])
+				if c < 0 {
+					return nil, false
+				}
+				w |= uint(c)
+			}
+		}
+		for i := 0; i < chars-1; i++ {
+			out = append(out, byte(w>>uint(16-8*i)))
+		}
+		s = s[chars:]
+	}
+	if len(out) < n {
+		return nil, false
+	}
+	return out[:n], true
+}
+
+// eksBlowfish is the expensive key schedule variant of Blowfish
+// that bcrypt is built on.
+type eksBlowfish struct {
+	p [18]uint32
+	s [4][256]uint32
+}
+
+func newEksBlowfish(cost int, salt, key []byte) *eksBlowfish {
+	bf := &eksBlowfish{p: blowfishP, s: blowfishS}
+	bf.expandKey(salt, key)
+	for i := uint64(0); i < 1<<uint(cost); i++ {
+		bf.expandKey(nil, key)
+		bf.expandKey(nil, salt)
+	}
+	return bf
+}
+
+// streamWord reads the next 32 bits from b starting at *pos,
+// wrapping around at the end.
+func streamWord(b []byte, pos *int) uint32 {
+	var w uint32
+	for i := 0; i < 4; i++ {
+		w = w<<8 | uint32(b[*pos])
+		*pos = (*pos + 1) % len(b)
+	}
+	return w
+}
+
+// expandKey mixes key into the subkeys.  If salt is not nil it is
+// mixed into the data being encrypted as the subkeys are replaced.
+func (bf *eksBlowfish) expandKey(salt, key []byte) {
+	kpos := 0
+	for i := range bf.p {
+		bf.p[i] ^= streamWord(key, &kpos)
+	}
+
+	spos := 0
+	var l, r uint32
+	next := func() {
+		if salt != nil {
+			l ^= streamWord(salt, &spos)
+			r ^= streamWord(salt, &spos)
+		}
+		l, r = bf.encrypt(l, r)
+	}
+	for i := 0; i < len(bf.p); i += 2 {
+		next()
+		bf.p[i], bf.p[i+1] = l, r
+	}
+	for i := range bf.s {
+		for j := 0; j < len(bf.s[i]); j += 2 {
+			next()
+			bf.s[i][j], bf.s[i][j+1] = l, r
+		}
+	}
+}
+
+func (bf *eksBlowfish) f(x uint32) uint32 {
+	return ((bf.s[0][x>>24] + bf.s[1][(x>>16)&0xff]) ^ bf.s[2][(x>>8)&0xff]) + bf.s[3][x&0xff]
+}
+
+func (bf *eksBlowfish) encrypt(l, r uint32) (uint32, uint32) {
+	l ^= bf.p[0]
+	for i := 1; i < 17; i += 2 {
+		r ^= bf.f(l) ^ bf.p[i]
+		l ^= bf.f(r) ^ bf.p[i+1]
+	}
+	r ^= bf.p[17]
+	return r, l
+}
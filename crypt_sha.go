@@ -0,0 +1,183 @@
+package shadow
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// shaVariant describes one of the two SHA-crypt algorithms, as
+// specified by Ulrich Drepper in "Unix crypt using SHA-256 and
+// SHA-512".
+type shaVariant struct {
+	prefix string
+	new    func() hash.Hash
+
+	// order lists the digest bytes in the order they are encoded,
+	// three at a time.
+	order []int
+}
+
+const (
+	shaDefaultRounds = 5000
+	shaMinRounds     = 1000
+	shaMaxRounds     = 999999999
+	shaMaxSalt       = 16
+)
+
+var sha256Crypt = &shaVariant{
+	prefix: "$5$",
+	new:    sha256.New,
+	order: []int{
+		0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14,
+		15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29,
+		31, 30,
+	},
+}
+
+var sha512Crypt = &shaVariant{
+	prefix: "$6$",
+	new:    sha512.New,
+	order: []int{
+		0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4,
+		47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+		31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35,
+		15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+		62, 20, 41, 63,
+	},
+}
+
+func shaGenSalt(v *shaVariant, rounds int) (string, error) {
+	salt, err := randomSalt(shaMaxSalt)
+	if err != nil {
+		return "", err
+	}
+	if rounds == 0 {
+		return v.prefix + salt, nil
+	}
+	return v.prefix + "rounds=" + strconv.Itoa(rounds) + "$" + salt, nil
+}
+
+func shaCrypt(v *shaVariant, key, setting string) (string, error) {
+	rounds, custom, rest, err := parseRounds(strings.TrimPrefix(setting, v.prefix))
+	if err != nil {
+		return "", err
+	}
+	if !custom {
+		rounds = shaDefaultRounds
+	}
+	if rounds < shaMinRounds {
+		rounds = shaMinRounds
+	}
+	if rounds > shaMaxRounds {
+		rounds = shaMaxRounds
+	}
+	salt := cutSetting(rest)
+	if len(salt) > shaMaxSalt {
+		salt = salt[:shaMaxSalt]
+	}
+
+	k := []byte(key)
+	s := []byte(salt)
+
+	// Digest B is key, salt, key.
+	h := v.new()
+	h.Write(k)
+	h.Write(s)
+	h.Write(k)
+	b := h.Sum(nil)
+
+	// Digest A is key, salt, then B repeated to the length of the
+	// key, and then either B or the key for every bit in the
+	// length of the key.
+	h.Reset()
+	h.Write(k)
+	h.Write(s)
+	h.Write(repeatTo(b, len(k)))
+	for n := len(k); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(k)
+		}
+	}
+	a := h.Sum(nil)
+
+	// Sequence P is derived from the key repeated once for every
+	// byte in it.
+	h.Reset()
+	for range k {
+		h.Write(k)
+	}
+	p := repeatTo(h.Sum(nil), len(k))
+
+	// Sequence S is derived from the salt repeated 16 times plus
+	// the value of the first byte of A.
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	ss := repeatTo(h.Sum(nil), len(s))
+
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(a)
+		}
+		if i%3 != 0 {
+			h.Write(ss)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(a)
+		} else {
+			h.Write(p)
+		}
+		a = h.Sum(a[:0])
+	}
+
+	out := new(strings.Builder)
+	out.WriteString(v.prefix)
+	if custom {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.WriteString(salt)
+	out.WriteByte('$')
+
+	o := v.order
+	for len(o) >= 3 {
+		writeCrypt64(out, uint(a[o[0]])<<16|uint(a[o[1]])<<8|uint(a[o[2]]), 4)
+		o = o[3:]
+	}
+	switch len(o) {
+	case 1:
+		writeCrypt64(out, uint(a[o[0]]), 2)
+	case 2:
+		writeCrypt64(out, uint(a[o[0]])<<8|uint(a[o[1]]), 3)
+	}
+	return out.String(), nil
+}
+
+// repeatTo returns b repeated and truncated to be exactly n bytes.
+func repeatTo(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, b...)
+	}
+	return out[:n]
+}
+
+// writeCrypt64 writes n characters encoding w, least significant six
+// bits first.
+func writeCrypt64(out *strings.Builder, w uint, n int) {
+	for ; n > 0; n-- {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
@@ -0,0 +1,189 @@
+package shadow
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrypt(t *testing.T) {
+	// Expected values are from libxcrypt.
+	cases := []struct {
+		key     string
+		setting string
+		want    string
+	}{
+		{
+			key:     "password",
+			setting: "$6$saltstring",
+			want:    "$6$saltstring$adDbXsJjcDlq2662QPgd.tkSOVmnG9Tt3oXl4HR60SusC3AGjirnDenVZp3DGwLwqy6iYKCzannhaX9DR72nN1",
+		},
+		{
+			key:     "correct horse battery staple",
+			setting: "$6$rounds=1000$toolongsaltstringXX",
+			want:    "$6$rounds=1000$toolongsaltstrin$DplM6HAKVKevPzplP8CcrCmDlG5c3jlSC1JMae5.G7hPOzoKSod.MjbpoLaQ89ieUmpRh8mtZ442WaVzBM4dP.",
+		},
+		{
+			key:     "Hello world!",
+			setting: "$5$saltstring",
+			want:    "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		},
+		{
+			key:     "correct horse battery staple",
+			setting: "$5$rounds=10000$saltstringsaltstring",
+			want:    "$5$rounds=10000$saltstringsaltst$/8xNziK9e6bV8Ug7BN1rAvEE.fnpxG4NQxl11Kk0LuB",
+		},
+		{
+			key:     "password",
+			setting: "$2b$05$CCCCCCCCCCCCCCCCCCCCC.",
+			want:    "$2b$05$CCCCCCCCCCCCCCCCCCCCC.aDV7CQarKHMuNfh2oJkFzsHZya4whFe",
+		},
+		{
+			key:     "correct horse battery staple",
+			setting: "$2a$04$......................",
+			want:    "$2a$04$......................DunJ0NhOinbZprl1sCtuSWfJkZJJgCO",
+		},
+		{
+			key:     strings.Repeat("x", 80),
+			setting: "$2b$04$abcdefghijklmnopqrstuu",
+			want:    "$2b$04$abcdefghijklmnopqrstuubzadhGtS2zEF.gu0yd0opP6cVzb.e0i",
+		},
+		{
+			key:     "password",
+			setting: "$y$j9T$F5Jx5fExrKuPp53xLKQ..1$",
+			want:    "$y$j9T$F5Jx5fExrKuPp53xLKQ..1$tnSYvahCwPBHKZUspmcxMfb0.WiB9W.zEaKlOBL35rC",
+		},
+		{
+			key:     "",
+			setting: "$y$j9T$F5Jx5fExrKuPp53xLKQ..1",
+			want:    "$y$j9T$F5Jx5fExrKuPp53xLKQ..1$5P1uc1zvKhieqEtKttbwCQrTPXpY1cK9wEnTDKAqLD8",
+		},
+		{
+			key:     "correct horse battery staple",
+			setting: "$y$j75$CCCCCCCCCCCCCCCCCCCCC.",
+			want:    "$y$j75$CCCCCCCCCCCCCCCCCCCCC.$TzTOv0L9sGOun7KFPq7XuIZSkIkwVVlr8JbUwK.PJc9",
+		},
+		{
+			key:     "correct horse battery staple",
+			setting: "$y$jD5$abcdefghijklmnop",
+			want:    "$y$jD5$abcdefghijklmnop$19ALPpFoJ2Zg6I5G3jqPiJo2pfQlRo2Nqsd3uCtMLK1",
+		},
+	}
+
+	for i, c := range cases {
+		got, err := Crypt(c.key, c.setting)
+		if err != nil {
+			t.Errorf("%d: Got error %v", i, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%d: Got %s; Want %s", i, got, c.want)
+		}
+
+		// A complete hash works as a setting too.
+		again, err := Crypt(c.key, got)
+		if err != nil || again != got {
+			t.Errorf("%d: Got %s, %v from hash; Want %s", i, again, err, got)
+		}
+	}
+}
+
+func TestCryptErrors(t *testing.T) {
+	cases := []struct {
+		setting string
+		wantErr error
+	}{
+		{"ab", ErrUnsupportedHash},
+		{"$1$saltsalt", ErrUnsupportedHash},
+		{"$6$rounds=lots$salt", ErrInvalidHash},
+		{"$2b$03$CCCCCCCCCCCCCCCCCCCCC.", ErrInvalidHash},
+		{"$2b$05$CCCC", ErrInvalidHash},
+		{"$y$j9T", ErrInvalidHash},
+		{"$y$j9T$*salt", ErrInvalidHash},
+		{"$y$jD51.$abcdefghijklmnop", ErrUnsupportedHash},
+	}
+
+	for _, c := range cases {
+		if _, err := Crypt("password", c.setting); err != c.wantErr {
+			t.Errorf("%s: Got %v; Want %v", c.setting, err, c.wantErr)
+		}
+	}
+}
+
+func TestScrypt(t *testing.T) {
+	// With no flags yescrypt is scrypt, so check it against RFC 7914.
+	want := "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162" +
+		"2eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"
+	got := yescryptKDF([]byte("password"), []byte("NaCl"), yescryptParams{n: 1024, r: 8, p: 16}, 64)
+	if hex.EncodeToString(got) != want {
+		t.Errorf("Got %x; Want %s", got, want)
+	}
+}
+
+func TestGenSalt(t *testing.T) {
+	cases := []struct {
+		method string
+		rounds int
+		prefix string
+	}{
+		{MethodSHA512, 0, "$6$"},
+		{MethodSHA256, 5000, "$5$rounds=5000$"},
+		{"bcrypt", 0, "$2b$10$"},
+		{MethodBcrypt, 4, "$2b$04$"},
+		{MethodYescrypt, 0, "$y$j9T$"},
+		{MethodYescrypt, 1, "$y$j75$"},
+	}
+
+	for _, c := range cases {
+		s, err := GenSalt(c.method, c.rounds)
+		if err != nil {
+			t.Errorf("%s: Got error %v", c.method, err)
+			continue
+		}
+		if !strings.HasPrefix(s, c.prefix) {
+			t.Errorf("%s: Got %s; Want prefix %s", c.method, s, c.prefix)
+		}
+	}
+
+	if _, err := GenSalt("MD5", 0); err != ErrUnsupportedHash {
+		t.Errorf("MD5: Got %v; Want %v", err, ErrUnsupportedHash)
+	}
+	if _, err := GenSalt(MethodYescrypt, 12); err != ErrInvalidHash {
+		t.Errorf("YESCRYPT 12: Got %v; Want %v", err, ErrInvalidHash)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	for _, m := range []string{MethodSHA256, MethodSHA512, MethodBcrypt, MethodYescrypt} {
+		se := &ShadowEntry{Login: "maldridge", Password: "!"}
+		rounds := 0
+		if m == MethodBcrypt {
+			rounds = 4
+		} else if m == MethodYescrypt {
+			rounds = 1
+		}
+		if err := se.SetPassword("hunter2", m, rounds); err != nil {
+			t.Errorf("%s: Got error %v", m, err)
+			continue
+		}
+		if !se.HasLastChanged || !se.LastChanged.Equal(dayOf(time.Now())) {
+			t.Errorf("%s: LastChanged not set to today: %v", m, se.LastChanged)
+		}
+		if !se.VerifyPassword("hunter2") {
+			t.Errorf("%s: Password did not verify", m)
+		}
+		if se.VerifyPassword("hunter3") {
+			t.Errorf("%s: Wrong password verified", m)
+		}
+	}
+}
+
+func TestVerifyPasswordUnusable(t *testing.T) {
+	for _, p := range []string{"", "!", "*", "!$6$saltstring$adDbXsJjcDlq2662QPgd"} {
+		se := &ShadowEntry{Login: "maldridge", Password: p}
+		if se.VerifyPassword("") {
+			t.Errorf("%q: Verified", p)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package shadow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"strings"
+)
+
+// The yescrypt implementation here follows the reference
+// implementation by Solar Designer, restricted to the parameters that
+// can appear in a "$y$" hash without a ROM.
+
+const (
+	yescryptRW          = 0x002
+	yescryptDefaults    = 0x0b6
+	yescryptFlavorMask  = 0x3fc
+	yescryptPrehash     = 0x10000000
+	yescryptDefaultCost = 5
+	yescryptMaxCost     = 11
+	yescryptSaltLen     = 16
+	yescryptHashLen     = 32
+	yescryptMaxSaltLen  = 64
+
+	// yescryptMaxMem bounds the memory a hash may ask for, so that a
+	// hostile setting cannot exhaust it.  The largest cost factor
+	// uses 1 GiB.
+	yescryptMaxMem = 1 << 32
+
+	pwxSimple = 2
+	pwxGather = 4
+	pwxRounds = 6
+	sWidth    = 8
+	sWords    = 3 * (1 << sWidth) * pwxSimple * 2
+	sMask     = ((1 << sWidth) - 1) * pwxSimple * 8
+)
+
+type yescryptParams struct {
+	flags uint32
+	n     uint64
+	r     int
+	p     int
+	t     uint32
+}
+
+func yescryptGenSalt(cost int) (string, error) {
+	if cost == 0 {
+		cost = yescryptDefaultCost
+	}
+	if cost < 1 || cost > yescryptMaxCost {
+		return "", ErrInvalidHash
+	}
+	nLog2, r := cost+7, 32
+	if cost < 3 {
+		nLog2, r = cost+9, 8
+	}
+
+	salt := make([]byte, yescryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	out := new(strings.Builder)
+	out.WriteString("$y$")
+	writeYescryptUint(out, yescryptRW+yescryptDefaults>>2, 0)
+	writeYescryptUint(out, uint32(nLog2), 1)
+	writeYescryptUint(out, uint32(r), 1)
+	out.WriteByte('$')
+	writeYescrypt64(out, salt)
+	return out.String(), nil
+}
+
+func yescryptCrypt(key, setting string) (string, error) {
+	p := yescryptParams{p: 1}
+	s := strings.TrimPrefix(setting, "$y$")
+
+	flavor, s, ok := readYescryptUint(s, 0)
+	if !ok {
+		return "", ErrInvalidHash
+	}
+	switch {
+	case flavor < yescryptRW:
+		p.flags = flavor
+	case flavor <= yescryptRW+yescryptFlavorMask>>2:
+		p.flags = yescryptRW + (flavor-yescryptRW)<<2
+	default:
+		return "", ErrInvalidHash
+	}
+	if p.flags&yescryptRW != 0 && p.flags != yescryptDefaults {
+		// Only the default pwxform parameters are implemented.
+		return "", ErrUnsupportedHash
+	}
+
+	nLog2, s, ok := readYescryptUint(s, 1)
+	if !ok || nLog2 > 63 {
+		return "", ErrInvalidHash
+	}
+	p.n = 1 << nLog2
+
+	r, s, ok := readYescryptUint(s, 1)
+	if !ok {
+		return "", ErrInvalidHash
+	}
+	p.r = int(r)
+
+	if s != "" && s[0] != '$' {
+		var have, v uint32
+		if have, s, ok = readYescryptUint(s, 1); !ok {
+			return "", ErrInvalidHash
+		}
+		if have&1 != 0 {
+			if v, s, ok = readYescryptUint(s, 2); !ok {
+				return "", ErrInvalidHash
+			}
+			p.p = int(v)
+		}
+		if have&2 != 0 {
+			if p.t, s, ok = readYescryptUint(s, 1); !ok {
+				return "", ErrInvalidHash
+			}
+		}
+		if have&^3 != 0 {
+			// Hash upgrades and ROMs are not supported.
+			return "", ErrUnsupportedHash
+		}
+	}
+	if s == "" || s[0] != '$' {
+		return "", ErrInvalidHash
+	}
+	s = s[1:]
+
+	saltStr := s
+	if i := strings.LastIndexByte(s, '$'); i >= 0 {
+		saltStr = s[:i]
+	}
+	salt, ok := readYescrypt64(saltStr)
+	if !ok || len(salt) > yescryptMaxSaltLen {
+		return "", ErrInvalidHash
+	}
+
+	if p.n <= 1 || p.r < 1 || p.p < 1 ||
+		uint64(p.r)*uint64(p.p) >= 1<<30 ||
+		p.n > yescryptMaxMem/128/uint64(p.r) {
+		return "", ErrInvalidHash
+	}
+	if p.flags&yescryptRW != 0 && p.n/uint64(p.p) <= 1 {
+		return "", ErrInvalidHash
+	}
+
+	hash := yescryptKDF([]byte(key), salt, p, yescryptHashLen)
+
+	out := new(strings.Builder)
+	out.WriteString(setting[:len(setting)-len(s)+len(saltStr)])
+	out.WriteByte('$')
+	writeYescrypt64(out, hash)
+	return out.String(), nil
+}
+
+// yescryptKDF derives n bytes from passwd and salt.  With flags of 0
+// this is exactly scrypt.
+func yescryptKDF(passwd, salt []byte, p yescryptParams, n int) []byte {
+	if p.flags&yescryptRW != 0 &&
+		p.n/uint64(p.p) >= 0x100 && p.n/uint64(p.p)*uint64(p.r) >= 0x20000 {
+		pre := p
+		pre.flags |= yescryptPrehash
+		pre.n >>= 6
+		pre.t = 0
+		passwd = yescryptKDFBody(passwd, salt, pre, 32)
+	}
+	return yescryptKDFBody(passwd, salt, p, n)
+}
+
+func yescryptKDFBody(passwd, salt []byte, p yescryptParams, n int) []byte {
+	if p.flags != 0 {
+		key := "yescrypt"
+		if p.flags&yescryptPrehash != 0 {
+			key = "yescrypt-prehash"
+		}
+		passwd = hmacSHA256([]byte(key), passwd)
+	}
+
+	s := 32 * p.r
+	raw := pbkdf2SHA256(passwd, salt, 4*s*p.p)
+	if p.flags != 0 {
+		passwd = append([]byte(nil), raw[:32]...)
+	}
+
+	b := make([]uint32, s*p.p)
+	for i := range b {
+		b[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	v := make([]uint32, s*int(p.n))
+
+	if p.flags&yescryptRW != 0 {
+		smix(b, p.r, p.n, p.p, p.t, p.flags, v, passwd)
+	} else {
+		for i := 0; i < p.p; i++ {
+			smix(b[i*s:(i+1)*s], p.r, p.n, 1, p.t, p.flags, v, nil)
+		}
+	}
+
+	for i, w := range b {
+		binary.LittleEndian.PutUint32(raw[i*4:], w)
+	}
+	dk := pbkdf2SHA256(passwd, raw, n)
+
+	// The final steps match SCRAM, so that everything before them
+	// could be computed by a client.
+	if p.flags != 0 && p.flags&yescryptPrehash == 0 {
+		ck := hmacSHA256(dk[:32], []byte("Client Key"))
+		sk := sha256.Sum256(ck)
+		copy(dk, sk[:])
+	}
+	return dk
+}
+
+func smix(b []uint32, r int, n uint64, p int, t uint32, flags uint32, v []uint32, passwd []byte) {
+	s := 32 * r
+	rw := flags&yescryptRW != 0
+
+	nchunk := n / uint64(p)
+	nloopAll := nchunk
+	if rw {
+		if t <= 1 {
+			if t != 0 {
+				nloopAll *= 2
+			}
+			nloopAll = (nloopAll + 2) / 3
+		} else {
+			nloopAll *= uint64(t) - 1
+		}
+	} else if t != 0 {
+		if t == 1 {
+			nloopAll += (nloopAll + 1) / 2
+		}
+		nloopAll *= uint64(t)
+	}
+	var nloopRW uint64
+	if rw {
+		nloopRW = nloopAll / uint64(p)
+	}
+	nchunk &^= 1
+	nloopAll = (nloopAll + 1) &^ 1
+	nloopRW = (nloopRW + 1) &^ 1
+
+	ctx := make([]*pwxformCtx, p)
+	var vchunk uint64
+	for i := 0; i < p; i++ {
+		np := nchunk
+		if i == p-1 {
+			np = n - vchunk
+		}
+		bp := b[i*s : (i+1)*s]
+		vp := v[int(vchunk)*s:]
+		if rw {
+			sbox := make([]uint32, sWords)
+			smix1(bp, 1, sWords/32, 0, sbox, nil)
+			ctx[i] = &pwxformCtx{
+				s2: sbox[:sWords/3],
+				s1: sbox[sWords/3 : 2*sWords/3],
+				s0: sbox[2*sWords/3:],
+			}
+			if i == 0 {
+				key := make([]byte, 64)
+				for k, w := range bp[s-16:] {
+					binary.LittleEndian.PutUint32(key[k*4:], w)
+				}
+				copy(passwd, hmacSHA256(key, passwd))
+			}
+		}
+		smix1(bp, r, np, flags, vp, ctx[i])
+		smix2(bp, r, p2floor(np), nloopRW, flags, vp, ctx[i])
+		vchunk += nchunk
+	}
+
+	for i := 0; i < p; i++ {
+		smix2(b[i*s:(i+1)*s], r, n, nloopAll-nloopRW, flags&^yescryptRW, v, ctx[i])
+	}
+}
+
+// smixLoad copies b into x, shuffling each block into the order the
+// salsa20 core expects.
+func smixLoad(x, b []uint32) {
+	for k := 0; k < len(x); k += 16 {
+		for i := 0; i < 16; i++ {
+			x[k+i] = b[k+i*5%16]
+		}
+	}
+}
+
+// smixStore reverses smixLoad.
+func smixStore(b, x []uint32) {
+	for k := 0; k < len(x); k += 16 {
+		for i := 0; i < 16; i++ {
+			b[k+i*5%16] = x[k+i]
+		}
+	}
+}
+
+func smix1(b []uint32, r int, n uint64, flags uint32, v []uint32, ctx *pwxformCtx) {
+	s := 32 * r
+	x := make([]uint32, s)
+	y := make([]uint32, s)
+	smixLoad(x, b[:s])
+
+	for i := uint64(0); i < n; i++ {
+		copy(v[int(i)*s:], x)
+		if flags&yescryptRW != 0 && i > 1 {
+			j := int(wrap(integerify(x, r), i))
+			blkxor(x, v[j*s:(j+1)*s])
+		}
+		if ctx != nil {
+			blockmixPwxform(x, r, ctx)
+		} else {
+			blockmixSalsa8(x, y, r)
+		}
+	}
+
+	smixStore(b[:s], x)
+}
+
+func smix2(b []uint32, r int, n, nloop uint64, flags uint32, v []uint32, ctx *pwxformCtx) {
+	s := 32 * r
+	x := make([]uint32, s)
+	y := make([]uint32, s)
+	smixLoad(x, b[:s])
+
+	for i := uint64(0); i < nloop; i++ {
+		j := int(integerify(x, r) & (n - 1))
+		blkxor(x, v[j*s:(j+1)*s])
+		if flags&yescryptRW != 0 {
+			copy(v[j*s:], x)
+		}
+		if ctx != nil {
+			blockmixPwxform(x, r, ctx)
+		} else {
+			blockmixSalsa8(x, y, r)
+		}
+	}
+
+	smixStore(b[:s], x)
+}
+
+func blockmixSalsa8(b, y []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		blkxor(x[:], b[i*16:(i+1)*16])
+		salsa20(x[:], 8)
+		copy(y[i*16:], x[:])
+	}
+	for i := 0; i < r; i++ {
+		copy(b[i*16:(i+1)*16], y[i*2*16:])
+		copy(b[(i+r)*16:(i+r+1)*16], y[(i*2+1)*16:])
+	}
+}
+
+// A pwxformCtx holds the S-boxes and write position of pwxform.  The
+// three S-boxes are views onto the same memory and rotate roles after
+// every use.
+type pwxformCtx struct {
+	s0, s1, s2 []uint32
+	w          int
+}
+
+func blockmixPwxform(b []uint32, r int, ctx *pwxformCtx) {
+	var x [16]uint32
+	r1 := 2 * r
+	copy(x[:], b[(r1-1)*16:])
+	for i := 0; i < r1; i++ {
+		if r1 > 1 {
+			blkxor(x[:], b[i*16:(i+1)*16])
+		}
+		ctx.pwxform(&x)
+		copy(b[i*16:], x[:])
+	}
+	// With these parameters there is exactly one block left over
+	// for salsa20.
+	salsa20(b[(r1-1)*16:r1*16], 2)
+}
+
+func (ctx *pwxformCtx) pwxform(x *[16]uint32) {
+	s0, s1, s2, w := ctx.s0, ctx.s1, ctx.s2, ctx.w
+	for i := 0; i < pwxRounds; i++ {
+		for j := 0; j < pwxGather; j++ {
+			xj := x[j*pwxSimple*2:]
+			p0 := s0[(xj[0]&sMask)/8*2:]
+			p1 := s1[(xj[1]&sMask)/8*2:]
+			for k := 0; k < pwxSimple; k++ {
+				a := uint64(p0[k*2+1])<<32 | uint64(p0[k*2])
+				c := uint64(p1[k*2+1])<<32 | uint64(p1[k*2])
+				v := (uint64(xj[k*2+1])*uint64(xj[k*2]) + a) ^ c
+				xj[k*2] = uint32(v)
+				xj[k*2+1] = uint32(v >> 32)
+				if i != 0 && i != pwxRounds-1 {
+					s2[w*2] = uint32(v)
+					s2[w*2+1] = uint32(v >> 32)
+					w++
+				}
+			}
+		}
+	}
+	ctx.s0, ctx.s1, ctx.s2 = s2, s0, s1
+	ctx.w = w & ((1<<sWidth)*pwxSimple - 1)
+}
+
+// salsa20 applies the Salsa20 core with the given number of rounds
+// to a block stored in the shuffled order used by smix.
+func salsa20(b []uint32, rounds int) {
+	var x [16]uint32
+	for i := 0; i < 16; i++ {
+		x[i*5%16] = b[i]
+	}
+
+	rotl := func(a uint32, n uint) uint32 { return a<<n | a>>(32-n) }
+	for i := 0; i < rounds; i += 2 {
+		x[4] ^= rotl(x[0]+x[12], 7)
+		x[8] ^= rotl(x[4]+x[0], 9)
+		x[12] ^= rotl(x[8]+x[4], 13)
+		x[0] ^= rotl(x[12]+x[8], 18)
+		x[9] ^= rotl(x[5]+x[1], 7)
+		x[13] ^= rotl(x[9]+x[5], 9)
+		x[1] ^= rotl(x[13]+x[9], 13)
+		x[5] ^= rotl(x[1]+x[13], 18)
+		x[14] ^= rotl(x[10]+x[6], 7)
+		x[2] ^= rotl(x[14]+x[10], 9)
+		x[6] ^= rotl(x[2]+x[14], 13)
+		x[10] ^= rotl(x[6]+x[2], 18)
+		x[3] ^= rotl(x[15]+x[11], 7)
+		x[7] ^= rotl(x[3]+x[15], 9)
+		x[11] ^= rotl(x[7]+x[3], 13)
+		x[15] ^= rotl(x[11]+x[7], 18)
+
+		x[1] ^= rotl(x[0]+x[3], 7)
+		x[2] ^= rotl(x[1]+x[0], 9)
+		x[3] ^= rotl(x[2]+x[1], 13)
+		x[0] ^= rotl(x[3]+x[2], 18)
+		x[6] ^= rotl(x[5]+x[4], 7)
+		x[7] ^= rotl(x[6]+x[5], 9)
+		x[4] ^= rotl(x[7]+x[6], 13)
+		x[5] ^= rotl(x[4]+x[7], 18)
+		x[11] ^= rotl(x[10]+x[9], 7)
+		x[8] ^= rotl(x[11]+x[10], 9)
+		x[9] ^= rotl(x[8]+x[11], 13)
+		x[10] ^= rotl(x[9]+x[8], 18)
+		x[12] ^= rotl(x[15]+x[14], 7)
+		x[13] ^= rotl(x[12]+x[15], 9)
+		x[14] ^= rotl(x[13]+x[12], 13)
+		x[15] ^= rotl(x[14]+x[13], 18)
+	}
+
+	for i := 0; i < 16; i++ {
+		b[i] += x[i*5%16]
+	}
+}
+
+func blkxor(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+func integerify(x []uint32, r int) uint64 {
+	last := x[(2*r-1)*16:]
+	return uint64(last[13])<<32 + uint64(last[0])
+}
+
+// p2floor returns the largest power of 2 not greater than x.
+func p2floor(x uint64) uint64 {
+	for y := x & (x - 1); y != 0; y = x & (x - 1) {
+		x = y
+	}
+	return x
+}
+
+func wrap(x, i uint64) uint64 {
+	n := p2floor(i)
+	return (x & (n - 1)) + (i - n)
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// pbkdf2SHA256 is PBKDF2 with HMAC-SHA256 and a single iteration,
+// which is all that scrypt and yescrypt need.
+func pbkdf2SHA256(passwd, salt []byte, n int) []byte {
+	mac := hmac.New(sha256.New, passwd)
+	out := make([]byte, 0, n+sha256.Size)
+	var ctr [4]byte
+	for i := uint32(1); len(out) < n; i++ {
+		mac.Reset()
+		mac.Write(salt)
+		binary.BigEndian.PutUint32(ctr[:], i)
+		mac.Write(ctr[:])
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
+
+// writeYescryptUint writes a yescrypt parameter, which uses a variable
+// length encoding in which the first character also gives the length.
+func writeYescryptUint(out *strings.Builder, v, min uint32) {
+	start, end, chars, bits := uint32(0), uint32(47), 1, uint(0)
+	v -= min
+	for {
+		count := (end + 1 - start) << bits
+		if v < count {
+			break
+		}
+		start = end + 1
+		end = start + (62-end)/2
+		v -= count
+		chars++
+		bits += 6
+	}
+	out.WriteByte(cryptAlphabet[start+v>>bits])
+	for chars--; chars > 0; chars-- {
+		bits -= 6
+		out.WriteByte(cryptAlphabet[(v>>bits)&0x3f])
+	}
+}
+
+// readYescryptUint reverses writeYescryptUint, returning the value and
+// the rest of s.
+func readYescryptUint(s string, min uint32) (uint32, string, bool) {
+	if s == "" {
+		return 0, "", false
+	}
+	c := atoi64(s[0])
+	if c < 0 {
+		return 0, "", false
+	}
+	s = s[1:]
+
+	start, end, chars, bits := uint32(0), uint32(47), 1, uint(0)
+	v := min
+	for uint32(c) > end {
+		v += (end + 1 - start) << bits
+		start = end + 1
+		end = start + (62-end)/2
+		chars++
+		bits += 6
+	}
+	v += (uint32(c) - start) << bits
+
+	for chars--; chars > 0; chars-- {
+		if s == "" {
+			return 0, "", false
+		}
+		c := atoi64(s[0])
+		if c < 0 {
+			return 0, "", false
+		}
+		s = s[1:]
+		bits -= 6
+		v += uint32(c) << bits
+	}
+	return v, s, true
+}
+
+// writeYescrypt64 encodes b in groups of three bytes, least
+// significant first.  This is not the byte order used by the
+// SHA-crypt methods.
+func writeYescrypt64(out *strings.Builder, b []byte) {
+	for len(b) > 0 {
+		var v uint
+		n := 0
+		for ; n < 3 && n < len(b); n++ {
+			v |= uint(b[n]) << uint(8*n)
+		}
+		writeCrypt64(out, v, (8*n+5)/6)
+		b = b[n:]
+	}
+}
+
+// readYescrypt64 reverses writeYescrypt64.
+func readYescrypt64(s string) ([]byte, bool) {
+	out := []byte{}
+	for len(s) > 0 {
+		var v uint32
+		bits := uint(0)
+		for ; len(s) > 0 && bits < 24; bits += 6 {
+			c := atoi64(s[0])
+			if c < 0 {
+				return nil, false
+			}
+			v |= uint32(c) << bits
+			s = s[1:]
+		}
+		if bits < 12 {
+			return nil, false
+		}
+		for ; bits >= 8; bits -= 8 {
+			out = append(out, byte(v))
+			v >>= 8
+		}
+		if v != 0 {
+			return nil, false
+		}
+	}
+	return out, true
+}
@@ -0,0 +1,439 @@
+package shadow
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChangeKind is the kind of change made to an entry.
+type ChangeKind int
+
+// The kinds of change found by the Diff* functions.
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// A FieldChange is a single field of a modified entry, with its old
+// and new values.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// A Change is an entry that was added, removed or modified.  Old and
+// New are the entry as it would be written on either side, and are
+// empty on the side where the entry does not exist.  Fields lists the
+// fields of a modified entry that changed.  The values are not
+// redacted, but String and the unified diff redact password hashes.
+type Change struct {
+	Kind   ChangeKind
+	Entry  string
+	Old    string
+	New    string
+	Fields []FieldChange
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeModified:
+		parts := make([]string, len(c.Fields))
+		for i, f := range c.Fields {
+			parts[i] = fmt.Sprintf("%s %q -> %q", f.Field, redactField(f.Field, f.Old), redactField(f.Field, f.New))
+		}
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Entry, strings.Join(parts, ", "))
+	case ChangeAdded:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Entry, redactPassword(c.New))
+	default:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Entry, redactPassword(c.Old))
+	}
+}
+
+// A Diff is the difference between two versions of a database.
+// Entries are matched by login or group name.  Changes lists the
+// removed and modified entries in their old order, followed by the
+// added entries in their new order.
+type Diff struct {
+	File    string
+	Changes []Change
+
+	// old and new are the lines of both versions, for the unified
+	// diff.
+	old []string
+	new []string
+}
+
+// DiffPasswd compares two versions of the passwd database.  Either
+// map may be nil, which is the same as an empty one.
+func DiffPasswd(from, to *PasswdMap) *Diff {
+	return newDiff("passwd", passwdFields, from, to)
+}
+
+// DiffShadow compares two versions of the shadow database.  Either
+// map may be nil, which is the same as an empty one.
+func DiffShadow(from, to *ShadowMap) *Diff {
+	return newDiff("shadow", shadowFields, from, to)
+}
+
+// DiffGroup compares two versions of the group database.  Either map
+// may be nil, which is the same as an empty one.
+func DiffGroup(from, to *GroupMap) *Diff {
+	return newDiff("group", groupFields, from, to)
+}
+
+// newDiff compares the entries of two versions of a database.
+func newDiff(file string, names []string, fromMap, toMap recordMap) *Diff {
+	from, to := records(fromMap), records(toMap)
+	text := func(m recordMap, r []string) string {
+		if r == nil {
+			return ""
+		}
+		return m.String()
+	}
+	d := &Diff{
+		File:    file,
+		Changes: []Change{},
+		old:     splitLines(text(fromMap, from)),
+		new:     splitLines(text(toMap, to)),
+	}
+
+	// Entries are keyed by their first field, and the nth entry
+	// with the same key on one side is matched with the nth on the
+	// other.
+	keys := func(lines []string) ([]string, map[string]int) {
+		seen := make(map[string]int)
+		k := make([]string, len(lines))
+		idx := make(map[string]int, len(lines))
+		for i, l := range lines {
+			name := strings.SplitN(l, ":", 2)[0]
+			k[i] = fmt.Sprintf("%s:%d", name, seen[name])
+			seen[name]++
+			idx[k[i]] = i
+		}
+		return k, idx
+	}
+	m := &merge{names: names}
+	ok, _ := keys(from)
+	nk, nIdx := keys(to)
+	of, _ := m.split(from)
+	nf, _ := m.split(to)
+
+	matched := make(map[string]bool)
+	for i, k := range ok {
+		j, found := nIdx[k]
+		if !found {
+			d.Changes = append(d.Changes, Change{Kind: ChangeRemoved, Entry: of[i][0], Old: from[i]})
+			continue
+		}
+		matched[k] = true
+		if from[i] == to[j] {
+			continue
+		}
+		c := Change{Kind: ChangeModified, Entry: of[i][0], Old: from[i], New: to[j]}
+		for f := range names {
+			if of[i][f] != nf[j][f] {
+				c.Fields = append(c.Fields, FieldChange{Field: names[f], Old: of[i][f], New: nf[j][f]})
+			}
+		}
+		d.Changes = append(d.Changes, c)
+	}
+	for j, k := range nk {
+		if !matched[k] {
+			d.Changes = append(d.Changes, Change{Kind: ChangeAdded, Entry: nf[j][0], New: to[j]})
+		}
+	}
+	return d
+}
+
+// Empty reports if there are no differences at all, including in
+// lines that are not entries.
+func (d *Diff) Empty() bool {
+	if len(d.Changes) > 0 || len(d.old) != len(d.new) {
+		return false
+	}
+	for i := range d.old {
+		if d.old[i] != d.new[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the changes one per line.
+func (d *Diff) String() string {
+	b := new(strings.Builder)
+	for _, c := range d.Changes {
+		b.WriteString(d.File + ": " + c.String() + "\n")
+	}
+	return b.String()
+}
+
+// diffContext is the number of unchanged lines shown around changes
+// in a unified diff.
+const diffContext = 3
+
+// WriteUnified writes the difference between the complete text of
+// both versions to w as a unified diff, with password hashes
+// redacted.  A line whose only change is its password hash is still
+// shown as changed.  Nothing is written if there are no differences.
+func (d *Diff) WriteUnified(w io.Writer) error {
+	ops := diffLines(d.old, d.new)
+
+	b := new(strings.Builder)
+	for start := 0; start < len(ops); {
+		// Find the next change, and the end of the hunk around
+		// it, which extends while changes are close enough to
+		// share context.
+		first := start
+		for first < len(ops) && ops[first].op == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].op != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		if b.Len() == 0 {
+			fmt.Fprintf(b, "--- a/%s\n+++ b/%s\n", d.File, d.File)
+		}
+		oldStart, oldCount, newStart, newCount := ops[from].old, 0, ops[from].new, 0
+		for _, o := range ops[from:to] {
+			if o.op != '+' {
+				oldCount++
+			}
+			if o.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+		for _, o := range ops[from:to] {
+			line := o.line
+			if !ignored(line) {
+				line = redactPassword(line)
+			}
+			b.WriteByte(o.op)
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+		start = to
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Unified returns the unified diff written by WriteUnified.
+func (d *Diff) Unified() string {
+	b := new(strings.Builder)
+	d.WriteUnified(b)
+	return b.String()
+}
+
+// hunkRange formats the range of a hunk, where start is the 0-based
+// index of its first line.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// diffOp is one line of an edit script.  Op is ' ' for a line kept,
+// '-' for one removed and '+' for one added, and old and new are the
+// indexes of the line on either side.
+type diffOp struct {
+	op   byte
+	line string
+	old  int
+	new  int
+}
+
+// diffLines computes an edit script from a to b with the algorithm
+// from Myers' "An O(ND) Difference Algorithm and Its Variations", in
+// its linear space form.  Its cost grows with the number of lines
+// that differ rather than with the size of the databases.
+func diffLines(a, b []string) []diffOp {
+	d := &differ{a: a, b: b, ops: make([]diffOp, 0, len(a)+len(b))}
+	d.compare(0, len(a), 0, len(b))
+
+	// Removed lines are shown before the lines added in their
+	// place, as diff(1) does.
+	ops := d.ops
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+		j := i
+		removed := []diffOp{}
+		added := []diffOp{}
+		for ; j < len(ops) && ops[j].op != ' '; j++ {
+			if ops[j].op == '-' {
+				removed = append(removed, ops[j])
+			} else {
+				added = append(added, ops[j])
+			}
+		}
+		o, n := ops[i].old, ops[i].new
+		for k, op := range removed {
+			op.old, op.new = o+k, n
+			ops[i+k] = op
+		}
+		for k, op := range added {
+			op.old, op.new = o+len(removed), n+k
+			ops[i+len(removed)+k] = op
+		}
+		i = j
+	}
+	return ops
+}
+
+// differ holds the state of diffLines.
+type differ struct {
+	a, b []string
+	ops  []diffOp
+}
+
+// compare appends the edit script from a[a0:a1] to b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, diffOp{' ', d.a[a0], a0, b0})
+		a0++
+		b0++
+	}
+	suf := 0
+	for a0 < a1-suf && b0 < b1-suf && d.a[a1-1-suf] == d.b[b1-1-suf] {
+		suf++
+	}
+	a1 -= suf
+	b1 -= suf
+
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.ops = append(d.ops, diffOp{'+', d.b[j], a0, j})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.ops = append(d.ops, diffOp{'-', d.a[i], i, b0})
+		}
+	default:
+		// As the ends are stripped, at least two edits are
+		// needed, so both halves are smaller than the whole.
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.ops = append(d.ops, diffOp{' ', d.a[x], x, y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for k := 0; k < suf; k++ {
+		d.ops = append(d.ops, diffOp{' ', d.a[a1+k], a1 + k, b1 + k})
+	}
+}
+
+// middleSnake finds the run of matching lines, from (x, y) to (u, v),
+// in the middle of a shortest edit script from a[a0:a1] to b[b0:b1],
+// by searching forward from the start and backward from the end at
+// the same time until the searches meet.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+
+	// vf[off+k] is the furthest x reached on diagonal k = x - y
+	// going forward, and vb[off+k] the furthest distance from the
+	// end reached on diagonal k counted from the end.
+	off := max + 1
+	vf := make([]int, 2*max+3)
+	vb := make([]int, 2*max+3)
+
+	for e := 0; e <= max; e++ {
+		for k := -e; k <= e; k += 2 {
+			x := vf[off+k-1] + 1
+			if k == -e || k != e && vf[off+k-1] < vf[off+k+1] {
+				x = vf[off+k+1]
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kr := delta - k; odd && kr >= -(e-1) && kr <= e-1 && x+vb[off+kr] >= n {
+				return a0 + sx, b0 + sy, a0 + x, b0 + y
+			}
+		}
+		for k := -e; k <= e; k += 2 {
+			x := vb[off+k-1] + 1
+			if k == -e || k != e && vb[off+k-1] < vb[off+k+1] {
+				x = vb[off+k+1]
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[a1-1-x] == d.b[b1-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -e && kf <= e && x+vf[off+kf] >= n {
+				return a1 - x, b1 - y, a1 - sx, b1 - sy
+			}
+		}
+	}
+	// Not reached, as the searches always meet.
+	return a0, b0, a0, b0
+}
+
+// splitLines splits the text of a database into lines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// redactField returns v, or a placeholder if it is a password hash.
+func redactField(name, v string) string {
+	if name == "password" && len(v) > 2 {
+		return "<redacted>"
+	}
+	return v
+}
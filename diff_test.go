@@ -0,0 +1,190 @@
+package shadow
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiffPasswd(t *testing.T) {
+	old, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"daemon:x:1:1::/:/sbin/nologin\n" +
+			"maldridge:x:1000:1000::/home/maldridge:/bin/sh\n"))
+	new, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"maldridge:x:1000:1000:Michael:/home/maldridge:/bin/zsh\n" +
+			"build:x:1001:1001::/var/build:/sbin/nologin\n"))
+
+	d := DiffPasswd(old, new)
+	if d.Empty() {
+		t.Fatal("Diff is empty")
+	}
+	want := []struct {
+		kind   ChangeKind
+		entry  string
+		fields []string
+	}{
+		{ChangeRemoved, "daemon", nil},
+		{ChangeModified, "maldridge", []string{"comment", "shell"}},
+		{ChangeAdded, "build", nil},
+	}
+	if len(d.Changes) != len(want) {
+		t.Fatalf("Got %v", d.Changes)
+	}
+	for i, w := range want {
+		c := d.Changes[i]
+		if c.Kind != w.kind || c.Entry != w.entry || len(c.Fields) != len(w.fields) {
+			t.Errorf("%d: Got %v", i, c)
+			continue
+		}
+		for j, f := range w.fields {
+			if c.Fields[j].Field != f {
+				t.Errorf("%d: Got field %s; Want %s", i, c.Fields[j].Field, f)
+			}
+		}
+	}
+	if f := d.Changes[1].Fields[1]; f.Old != "/bin/sh" || f.New != "/bin/zsh" {
+		t.Errorf("Got %+v", f)
+	}
+
+	if !DiffPasswd(old, old).Empty() {
+		t.Error("Diff of a map with itself is not empty")
+	}
+	if d := DiffPasswd(nil, new); len(d.Changes) != 3 || d.Changes[0].Kind != ChangeAdded {
+		t.Errorf("Got %v", d.Changes)
+	}
+}
+
+func TestDiffUnified(t *testing.T) {
+	lines := []string{
+		"root:$6$old$hash:17518:0:99999:7:::",
+		"a:!:17518::::::",
+		"b:!:17518::::::",
+		"c:!:17518::::::",
+		"d:!:17518::::::",
+		"e:!:17518::::::",
+		"f:!:17518::::::",
+		"g:!:17518::::::",
+		"h:!:17518::::::",
+	}
+	old, _ := ParseShadowMap(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+	lines[0] = "root:$6$new$hash:18000:0:99999:7:::"
+	lines[8] = "h:*:17518::::::"
+	new, _ := ParseShadowMap(strings.NewReader(strings.Join(lines, "\n") + "\ni:!:18000::::::\n"))
+
+	d := DiffShadow(old, new)
+	want := `--- a/shadow
++++ b/shadow
+@@ -1,4 +1,4 @@
+-root:<redacted>:17518:0:99999:7:::
++root:<redacted>:18000:0:99999:7:::
+ a:!:17518::::::
+ b:!:17518::::::
+ c:!:17518::::::
+@@ -6,4 +6,5 @@
+ e:!:17518::::::
+ f:!:17518::::::
+ g:!:17518::::::
+-h:!:17518::::::
++h:*:17518::::::
++i:!:18000::::::
+`
+	if got := d.Unified(); got != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+	}
+	if strings.Contains(d.String(), "$6$") {
+		t.Errorf("Password hash in changes:\n%s", d)
+	}
+
+	if got := DiffShadow(old, old).Unified(); got != "" {
+		t.Errorf("Got %q for no changes", got)
+	}
+}
+
+func TestDiffGroupComments(t *testing.T) {
+	old, _ := ParseGroupMap(strings.NewReader("root:x:0:\nwheel:x:10:root\n"))
+	new, _ := ParseGroupMap(strings.NewReader("# admins\nroot:x:0:\nwheel:x:10:root,maldridge\n"))
+
+	d := DiffGroup(old, new)
+	if len(d.Changes) != 1 || d.Changes[0].Fields[0].Field != "members" {
+		t.Errorf("Got %v", d.Changes)
+	}
+	want := "--- a/group\n+++ b/group\n@@ -1,2 +1,3 @@\n+# admins\n root:x:0:\n-wheel:x:10:root\n+wheel:x:10:root,maldridge\n"
+	if got := d.Unified(); got != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", got, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	// lcs is the length of the longest common subsequence, which a
+	// shortest edit script keeps.
+	lcs := func(a, b []string) int {
+		l := make([][]int, len(a)+1)
+		for i := range l {
+			l[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				switch {
+				case a[i] == b[j]:
+					l[i][j] = l[i+1][j+1] + 1
+				case l[i+1][j] > l[i][j+1]:
+					l[i][j] = l[i+1][j]
+				default:
+					l[i][j] = l[i][j+1]
+				}
+			}
+		}
+		return l[0][0]
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		out := make([]string, rng.Intn(12))
+		for i := range out {
+			out[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return out
+	}
+	for n := 0; n < 500; n++ {
+		a, b := lines(), lines()
+		ops := diffLines(a, b)
+		var gotA, gotB []string
+		kept := 0
+		for _, op := range ops {
+			if op.op != '+' {
+				if op.old != len(gotA) {
+					t.Fatalf("%v -> %v: Bad old position in %v", a, b, ops)
+				}
+				gotA = append(gotA, op.line)
+			}
+			if op.op != '-' {
+				if op.new != len(gotB) {
+					t.Fatalf("%v -> %v: Bad new position in %v", a, b, ops)
+				}
+				gotB = append(gotB, op.line)
+			}
+			if op.op == ' ' {
+				kept++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("%v -> %v: Got %v", a, b, ops)
+		}
+		if want := lcs(a, b); kept != want {
+			t.Errorf("%v -> %v: Kept %d lines; Want %d", a, b, kept, want)
+		}
+	}
+
+	// A large database with few changes is cheap to compare.
+	a := make([]string, 8000)
+	for i := range a {
+		a[i] = fmt.Sprintf("user%d:x:%d:%d::/home/user%d:/bin/sh", i, i, i, i)
+	}
+	b := append(append([]string{"first:x:1:1::/:/bin/sh"}, a...), "last:x:2:2::/:/bin/sh")
+	if ops := diffLines(a, b); len(ops) != len(b) || ops[0].op != '+' || ops[len(ops)-1].op != '+' {
+		t.Errorf("Got %d operations", len(ops))
+	}
+}
@@ -1,6 +1,11 @@
 package shadow
 
-import "errors"
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
 
 var (
 	// ErrWrongNumFields is returned when a record which should
@@ -11,4 +16,177 @@ var (
 	// ErrNotANumber is returned when a field that must be a
 	// number cannot be parsed as one.
 	ErrNotANumber = errors.New("atoi failed during numerical parse")
+
+	// ErrNegativeValue is returned when a numeric field that must
+	// not be negative is.
+	ErrNegativeValue = errors.New("negative value in numerical field")
+
+	// ErrLocked is returned when a lock on the account databases
+	// is already held by another process and could not be
+	// obtained in time.
+	ErrLocked = errors.New("account database is locked")
+
+	// ErrLockUnsupported is returned on platforms where the
+	// shadow-utils locking convention cannot be honored.
+	ErrLockUnsupported = errors.New("database locking is not supported on this platform")
+
+	// ErrUserExists is returned when creating or renaming a user
+	// would collide with an existing login.
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrNoSuchUser is returned when an operation names a user
+	// that is not present.
+	ErrNoSuchUser = errors.New("no such user")
+
+	// ErrGroupExists is returned when creating or renaming a
+	// group would collide with an existing group name.
+	ErrGroupExists = errors.New("group already exists")
+
+	// ErrNoSuchGroup is returned when an operation names a group
+	// that is not present.
+	ErrNoSuchGroup = errors.New("no such group")
+
+	// ErrIDInUse is returned when an explicitly requested UID or
+	// GID is already taken.
+	ErrIDInUse = errors.New("id is already in use")
+
+	// ErrNoFreeID is returned when no unused UID or GID remains in
+	// the range being allocated from.
+	ErrNoFreeID = errors.New("no free id available in range")
+
+	// ErrInvalidCount is returned when a block of subordinate IDs
+	// is requested with a count that is not positive.
+	ErrInvalidCount = errors.New("subordinate id count must be positive")
+
+	// ErrGroupInUse is returned when deleting a group that is
+	// still the primary group of at least one user.
+	ErrGroupInUse = errors.New("group is the primary group of a user")
+
+	// ErrUnsupportedHash is returned when a password hash or
+	// hashing method is not one this package implements.
+	ErrUnsupportedHash = errors.New("unsupported password hash method")
+
+	// ErrInvalidHash is returned when a password hash or setting
+	// is malformed.
+	ErrInvalidHash = errors.New("malformed password hash")
+
+	// ErrEmptyPassword is returned when unlocking an account
+	// would leave it without a password.
+	ErrEmptyPassword = errors.New("unlocking would result in a passwordless account")
+
+	// ErrInvalidName is returned by Validate when a user or group
+	// name breaks the naming rules in effect.
+	ErrInvalidName = errors.New("invalid user or group name")
+
+	// ErrInvalidCharacter is returned by Validate when a field
+	// contains a character that would corrupt the database, such
+	// as a colon or a newline.
+	ErrInvalidCharacter = errors.New("field contains a separator or control character")
+
+	// ErrInvalidHome is returned by Validate when a home directory
+	// is not an absolute path.
+	ErrInvalidHome = errors.New("invalid home directory")
+
+	// ErrInvalidShell is returned by Validate when a shell is not
+	// an absolute path, or is rejected by the shell check.
+	ErrInvalidShell = errors.New("invalid login shell")
 )
+
+// A ParseError describes a record that could not be parsed.  It wraps
+// one of the errors above, so errors.Is can be used to find out what
+// was wrong with the record.
+type ParseError struct {
+	// Source is the name of the input, when it is known, and Line
+	// is the 1-based line of the record within it.
+	Source string
+	Line   int
+
+	// Field is the 1-based index of the offending field, or 0 if
+	// the problem is with the record as a whole.  FieldName is
+	// the name of the field as found in the manual page.
+	Field     int
+	FieldName string
+
+	// Text is the offending record.  Password hashes are
+	// redacted.
+	Text string
+
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	out := new(strings.Builder)
+	if e.Source != "" {
+		out.WriteString(e.Source + ":")
+	}
+	if e.Line > 0 {
+		out.WriteString(strconv.Itoa(e.Line) + ":")
+	}
+	if out.Len() > 0 {
+		out.WriteString(" ")
+	}
+	if e.Field > 0 {
+		out.WriteString("field " + strconv.Itoa(e.Field))
+		if e.FieldName != "" {
+			out.WriteString(" (" + e.FieldName + ")")
+		}
+		out.WriteString(": ")
+	}
+	out.WriteString(e.Err.Error())
+	if e.Text != "" {
+		out.WriteString(": " + strconv.Quote(e.Text))
+	}
+	return out.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// fieldError returns a ParseError for the field at index i of a
+// record whose fields are named by names.
+func fieldError(names []string, i int, err error) *ParseError {
+	return &ParseError{Field: i + 1, FieldName: names[i], Err: err}
+}
+
+// recordError returns a ParseError for a record as a whole.
+func recordError(err error) *ParseError {
+	return &ParseError{Err: err}
+}
+
+// lineError adds the position and text of the record to an error
+// returned by parsing it.  If redact is set the password field, which
+// is always the second, is redacted unless it is a short placeholder
+// such as "x" or "!".
+func lineError(err error, source string, line int, text string, redact bool) *ParseError {
+	pe, ok := err.(*ParseError)
+	if !ok {
+		pe = &ParseError{Err: err}
+	}
+	pe.Source = source
+	pe.Line = line
+	pe.Text = text
+	if redact {
+		pe.Text = redactPassword(text)
+	}
+	return pe
+}
+
+func redactPassword(s string) string {
+	fields := strings.SplitN(s, ":", 3)
+	if len(fields) < 2 || len(fields[1]) <= 2 {
+		return s
+	}
+	fields[1] = "<redacted>"
+	return strings.Join(fields, ":")
+}
+
+// sourceName returns the name of r if it has one, as an *os.File
+// does.
+func sourceName(r io.Reader) string {
+	if n, ok := r.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return ""
+}
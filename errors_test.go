@@ -0,0 +1,69 @@
+package shadow
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	_, err := ParsePasswdMap(strings.NewReader("root:x:0:0:root:/root:/bin/sh\nmaldridge:x:1000:potato:maldridge:/home/maldridge:/bin/sh\n"))
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Got %v; Want a ParseError", err)
+	}
+	if !errors.Is(err, ErrNotANumber) {
+		t.Errorf("Got %v; Want %v", err, ErrNotANumber)
+	}
+	if pe.Line != 2 || pe.Field != 4 || pe.FieldName != "gid" || pe.Source != "" {
+		t.Errorf("Got %+v", pe)
+	}
+	want := `2: field 4 (gid): atoi failed during numerical parse: "maldridge:x:1000:potato:maldridge:/home/maldridge:/bin/sh"`
+	if err.Error() != want {
+		t.Errorf("Got %s; Want %s", err, want)
+	}
+}
+
+func TestParseErrorSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "shadow")
+	data := "root:*:18000:0:99999:7:::\nmaldridge:$6$saltstring$hash:18000:0:99999:7::\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, err = ParseShadowMap(f)
+	if !errors.Is(err, ErrWrongNumFields) {
+		t.Fatalf("Got %v; Want %v", err, ErrWrongNumFields)
+	}
+	want := path + `:2: wrong number of fields in provided record: "maldridge:<redacted>:18000:0:99999:7::"`
+	if err.Error() != want {
+		t.Errorf("Got %s; Want %s", err, want)
+	}
+	if strings.Contains(err.Error(), "saltstring") {
+		t.Error("Password hash not redacted")
+	}
+}
+
+func TestParseErrorSubIDText(t *testing.T) {
+	// Subordinate ID files have no password, so the start of the
+	// range is quoted as it is.
+	_, err := ParseSubIDMap(strings.NewReader("maldridge:1000oops:65536\n"))
+	want := `1: field 2 (start): atoi failed during numerical parse: "maldridge:1000oops:65536"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Got %v; Want %s", err, want)
+	}
+}
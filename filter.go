@@ -1,5 +1,11 @@
 package shadow
 
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
 // A NumericFilter can be applied to the number fields of a type, and
 // provides a way to do filtering based on numeric ranging, not-below,
 // not-above etc.  The function should return true if an item matches
@@ -9,3 +15,388 @@ type NumericFilter func(int) bool
 // A StringFilter is exactly the same as a NumericFilter, but is
 // applied to strings instead.
 type StringFilter func(string) bool
+
+// Range matches numbers from min to max inclusive.
+func Range(min, max int) NumericFilter {
+	return func(i int) bool { return i >= min && i <= max }
+}
+
+// AtLeast matches numbers that are not below min.
+func AtLeast(min int) NumericFilter {
+	return func(i int) bool { return i >= min }
+}
+
+// AtMost matches numbers that are not above max.
+func AtMost(max int) NumericFilter {
+	return func(i int) bool { return i <= max }
+}
+
+// Equals matches exactly the number n.
+func Equals(n int) NumericFilter {
+	return func(i int) bool { return i == n }
+}
+
+// EqualsString matches exactly the string s.
+func EqualsString(s string) StringFilter {
+	return func(v string) bool { return v == s }
+}
+
+// Prefix matches strings that start with prefix.
+func Prefix(prefix string) StringFilter {
+	return func(v string) bool { return strings.HasPrefix(v, prefix) }
+}
+
+// Glob matches strings against a shell pattern, using the syntax of
+// path.Match.  An error is returned if the pattern is malformed.
+func Glob(pattern string) (StringFilter, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(v string) bool {
+		ok, _ := path.Match(pattern, v)
+		return ok
+	}, nil
+}
+
+// Regexp matches strings that contain a match of the regular
+// expression expr.  An error is returned if expr does not compile.
+func Regexp(expr string) (StringFilter, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// And matches if f and all of others match.
+func (f NumericFilter) And(others ...NumericFilter) NumericFilter {
+	return func(i int) bool {
+		if !f(i) {
+			return false
+		}
+		for _, o := range others {
+			if !o(i) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches if f or any of others match.
+func (f NumericFilter) Or(others ...NumericFilter) NumericFilter {
+	return func(i int) bool {
+		if f(i) {
+			return true
+		}
+		for _, o := range others {
+			if o(i) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches if f does not.
+func (f NumericFilter) Not() NumericFilter {
+	return func(i int) bool { return !f(i) }
+}
+
+// And matches if f and all of others match.
+func (f StringFilter) And(others ...StringFilter) StringFilter {
+	return func(s string) bool {
+		if !f(s) {
+			return false
+		}
+		for _, o := range others {
+			if !o(s) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches if f or any of others match.
+func (f StringFilter) Or(others ...StringFilter) StringFilter {
+	return func(s string) bool {
+		if f(s) {
+			return true
+		}
+		for _, o := range others {
+			if o(s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches if f does not.
+func (f StringFilter) Not() StringFilter {
+	return func(s string) bool { return !f(s) }
+}
+
+// A PasswdFilter is applied to whole passwd entries by
+// PasswdMap.Filter.  Filters for single fields are built with
+// PasswdLogin, PasswdUID and so on.
+type PasswdFilter func(*PasswdEntry) bool
+
+// PasswdLogin applies f to the login of an entry.
+func PasswdLogin(f StringFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool { return f(pe.Login) }
+}
+
+// PasswdUID applies f to the UID of an entry.  Compat entries that
+// do not override the UID never match.
+func PasswdUID(f NumericFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool {
+		return (pe.Compat() == CompatNone || pe.HasUID) && f(pe.UID)
+	}
+}
+
+// PasswdGID applies f to the primary GID of an entry.  Compat
+// entries that do not override the GID never match.
+func PasswdGID(f NumericFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool {
+		return (pe.Compat() == CompatNone || pe.HasGID) && f(pe.GID)
+	}
+}
+
+// PasswdComment applies f to the comment of an entry.
+func PasswdComment(f StringFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool { return f(pe.Comment) }
+}
+
+// PasswdHome applies f to the home directory of an entry.
+func PasswdHome(f StringFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool { return f(pe.Home) }
+}
+
+// PasswdShell applies f to the shell of an entry.
+func PasswdShell(f StringFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool { return f(pe.Shell) }
+}
+
+// And matches if f and all of others match.
+func (f PasswdFilter) And(others ...PasswdFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool {
+		if !f(pe) {
+			return false
+		}
+		for _, o := range others {
+			if !o(pe) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches if f or any of others match.
+func (f PasswdFilter) Or(others ...PasswdFilter) PasswdFilter {
+	return func(pe *PasswdEntry) bool {
+		if f(pe) {
+			return true
+		}
+		for _, o := range others {
+			if o(pe) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches if f does not.
+func (f PasswdFilter) Not() PasswdFilter {
+	return func(pe *PasswdEntry) bool { return !f(pe) }
+}
+
+// A ShadowFilter is applied to whole shadow entries by
+// ShadowMap.Filter.  The aging fields are filtered as numbers, with
+// dates given as days since the epoch, and fields that are not set
+// never match.
+type ShadowFilter func(*ShadowEntry) bool
+
+// ShadowLogin applies f to the login of an entry.
+func ShadowLogin(f StringFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool { return f(se.Login) }
+}
+
+// ShadowPassword applies f to the password hash of an entry.
+func ShadowPassword(f StringFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool { return f(se.Password) }
+}
+
+// ShadowLastChanged applies f to the day of the last password change.
+func ShadowLastChanged(f NumericFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		d := dayField(se.LastChanged, se.HasLastChanged)
+		return d >= 0 && f(d)
+	}
+}
+
+// ShadowMinimumAge applies f to the minimum password age.
+func ShadowMinimumAge(f NumericFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		return se.HasMinimumPasswordAge && f(se.MinimumPasswordAge)
+	}
+}
+
+// ShadowMaximumAge applies f to the maximum password age.
+func ShadowMaximumAge(f NumericFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		return se.HasMaximumPasswordAge && f(se.MaximumPasswordAge)
+	}
+}
+
+// ShadowWarningDays applies f to the password warning period.
+func ShadowWarningDays(f NumericFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		return se.HasWarningDays && f(se.WarningDays)
+	}
+}
+
+// ShadowInactivityDays applies f to the password inactivity period.
+func ShadowInactivityDays(f NumericFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		return se.HasInactivityDays && f(se.InactivityDays)
+	}
+}
+
+// ShadowExpiration applies f to the day the account expires.
+func ShadowExpiration(f NumericFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		d := dayField(se.Expiration, se.HasExpiration)
+		return d >= 0 && f(d)
+	}
+}
+
+// And matches if f and all of others match.
+func (f ShadowFilter) And(others ...ShadowFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		if !f(se) {
+			return false
+		}
+		for _, o := range others {
+			if !o(se) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches if f or any of others match.
+func (f ShadowFilter) Or(others ...ShadowFilter) ShadowFilter {
+	return func(se *ShadowEntry) bool {
+		if f(se) {
+			return true
+		}
+		for _, o := range others {
+			if o(se) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches if f does not.
+func (f ShadowFilter) Not() ShadowFilter {
+	return func(se *ShadowEntry) bool { return !f(se) }
+}
+
+// A GroupFilter is applied to whole group entries by
+// GroupMap.Filter.
+type GroupFilter func(*GroupEntry) bool
+
+// GroupName applies f to the name of a group.
+func GroupName(f StringFilter) GroupFilter {
+	return func(ge *GroupEntry) bool { return f(ge.Name) }
+}
+
+// GroupGID applies f to the GID of a group.  Compat entries that do
+// not override the GID never match.
+func GroupGID(f NumericFilter) GroupFilter {
+	return func(ge *GroupEntry) bool {
+		return (ge.Compat() == CompatNone || ge.HasGID) && f(ge.GID)
+	}
+}
+
+// GroupMember matches groups with at least one member that f
+// matches.
+func GroupMember(f StringFilter) GroupFilter {
+	return func(ge *GroupEntry) bool {
+		for _, m := range ge.UserList {
+			if f(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// And matches if f and all of others match.
+func (f GroupFilter) And(others ...GroupFilter) GroupFilter {
+	return func(ge *GroupEntry) bool {
+		if !f(ge) {
+			return false
+		}
+		for _, o := range others {
+			if !o(ge) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches if f or any of others match.
+func (f GroupFilter) Or(others ...GroupFilter) GroupFilter {
+	return func(ge *GroupEntry) bool {
+		if f(ge) {
+			return true
+		}
+		for _, o := range others {
+			if o(ge) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches if f does not.
+func (f GroupFilter) Not() GroupFilter {
+	return func(ge *GroupEntry) bool { return !f(ge) }
+}
+
+// A FilterOption changes which entries the Filter* methods consider.
+type FilterOption func(*filterOptions)
+
+type filterOptions struct {
+	compat bool
+}
+
+func newFilterOptions(opts []FilterOption) *filterOptions {
+	o := new(filterOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// IncludeCompat applies filters to NIS compat entries as well, which
+// are otherwise skipped.  Compat entries that do not override a
+// numeric field never match a filter on it.
+func IncludeCompat() FilterOption {
+	return func(o *filterOptions) { o.compat = true }
+}
+
+// skip reports if an entry of the given kind is left out.
+func (o *filterOptions) skip(kind CompatKind) bool {
+	return kind != CompatNone && !o.compat
+}
@@ -0,0 +1,118 @@
+package shadow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNumericFilters(t *testing.T) {
+	cases := []struct {
+		f    NumericFilter
+		in   int
+		want bool
+	}{
+		{Range(1000, 60000), 1000, true},
+		{Range(1000, 60000), 60001, false},
+		{AtLeast(1000), 999, false},
+		{AtMost(999), 999, true},
+		{Equals(0), 0, true},
+		{Equals(0), 1, false},
+		{AtLeast(10).And(AtMost(20)), 15, true},
+		{AtLeast(10).And(AtMost(20)), 25, false},
+		{Equals(0).Or(AtLeast(1000)), 0, true},
+		{Equals(0).Or(AtLeast(1000)), 500, false},
+		{Equals(0).Not(), 0, false},
+	}
+
+	for i, c := range cases {
+		if got := c.f(c.in); got != c.want {
+			t.Errorf("%d: Got %v; Want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestStringFilters(t *testing.T) {
+	glob, err := Glob("/home/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	re, err := Regexp("^[a-z]+[0-9]$")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		f    StringFilter
+		in   string
+		want bool
+	}{
+		{EqualsString("root"), "root", true},
+		{Prefix("/usr/"), "/usr/bin/zsh", true},
+		{Prefix("/usr/"), "/bin/sh", false},
+		{glob, "/home/maldridge", true},
+		{glob, "/home/a/b", false},
+		{re, "login2", true},
+		{re, "Login2", false},
+		{Prefix("/bin/").And(EqualsString("/bin/sh").Not()), "/bin/bash", true},
+		{Prefix("/bin/").And(EqualsString("/bin/sh").Not()), "/bin/sh", false},
+		{EqualsString("a").Or(EqualsString("b")), "b", true},
+	}
+
+	for i, c := range cases {
+		if got := c.f(c.in); got != c.want {
+			t.Errorf("%d: Got %v; Want %v", i, got, c.want)
+		}
+	}
+
+	if _, err := Glob("[a-"); err == nil {
+		t.Error("Glob accepted a malformed pattern")
+	}
+	if _, err := Regexp("("); err == nil {
+		t.Error("Regexp accepted a malformed expression")
+	}
+}
+
+func TestMapFilters(t *testing.T) {
+	pm, err := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"maldridge:x:1000:1000:Michael:/home/maldridge:/bin/zsh\n" +
+			"nobody:x:65534:65534::/:/sbin/nologin\n" +
+			"+::::::/bin/zsh\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zsh := PasswdShell(EqualsString("/bin/zsh"))
+	if got := pm.Filter(zsh); len(got) != 1 || got[0].Login != "maldridge" {
+		t.Errorf("Got %v", got)
+	}
+	if got := pm.Filter(zsh, IncludeCompat()); len(got) != 2 {
+		t.Errorf("Got %v; Want the compat entry as well", got)
+	}
+	if got := pm.Filter(PasswdUID(AtLeast(1000)).And(PasswdHome(Prefix("/home/")).Not())); len(got) != 1 || got[0].Login != "nobody" {
+		t.Errorf("Got %v", got)
+	}
+
+	sm, err := ParseShadowMap(strings.NewReader(
+		"root:*:17518:0:99999:7:::\n" +
+			"maldridge:!:17518:0:90:7::18000:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sm.Filter(ShadowMaximumAge(AtMost(90))); len(got) != 1 || got[0].Login != "maldridge" {
+		t.Errorf("Got %v", got)
+	}
+	if got := sm.Filter(ShadowExpiration(AtLeast(0))); len(got) != 1 {
+		t.Errorf("Got %v; Want only the entry with an expiry date", got)
+	}
+	if got := sm.Filter(ShadowLastChanged(Equals(17518))); len(got) != 2 {
+		t.Errorf("Got %v", got)
+	}
+
+	gm, err := ParseGroupMap(strings.NewReader("root:x:0:\nwheel:x:10:root,maldridge\nusers:x:100:maldridge\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gm.Filter(GroupMember(EqualsString("maldridge")).And(GroupName(EqualsString("users")).Not())); len(got) != 1 || got[0].Name != "wheel" {
+		t.Errorf("Got %v", got)
+	}
+}
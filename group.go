@@ -1,7 +1,7 @@
 package shadow
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -14,9 +14,25 @@ type GroupEntry struct {
 	Password string
 	GID      int
 	UserList []string
+
+	// HasGID reports if a compat entry overrides the GID.  It is
+	// not used by other entries, which always have one.
+	HasGID bool
 }
 
+// groupFields names the fields of a GroupEntry for errors.
+var groupFields = []string{"name", "password", "gid", "members"}
+
 func (ge GroupEntry) String() string {
+	if ge.Compat() != CompatNone {
+		if ge.Password == "" && !ge.HasGID && len(ge.UserList) == 0 {
+			return ge.Name
+		}
+		return ge.Name + ":" +
+			ge.Password + ":" +
+			optItoa(ge.GID, ge.HasGID) + ":" +
+			strings.Join(ge.UserList, ",")
+	}
 	return ge.Name + ":" +
 		ge.Password + ":" +
 		strconv.Itoa(ge.GID) + ":" +
@@ -24,11 +40,17 @@ func (ge GroupEntry) String() string {
 }
 
 // Parse reads a single entry of the group map.  Parsing will fail if
-// a group has too many members to load in a single pass.
+// a group has too many members to load in a single pass.  NIS compat
+// entries, which start with "+" or "-", may leave out trailing fields
+// and leave the GID empty.
 func (ge *GroupEntry) Parse(s string) error {
+	if compatKind(s) != CompatNone {
+		return ge.parseCompat(s)
+	}
+
 	fields := strings.Split(s, ":")
 	if len(fields) != 4 {
-		return ErrWrongNumFields
+		return recordError(ErrWrongNumFields)
 	}
 
 	ge.Name = fields[0]
@@ -37,7 +59,7 @@ func (ge *GroupEntry) Parse(s string) error {
 	gid, err := strconv.Atoi(fields[2])
 	if err != nil {
 		*ge = GroupEntry{}
-		return ErrNotANumber
+		return fieldError(groupFields, 2, ErrNotANumber)
 	}
 	ge.GID = gid
 
@@ -45,44 +67,81 @@ func (ge *GroupEntry) Parse(s string) error {
 	return nil
 }
 
+func (ge *GroupEntry) parseCompat(s string) error {
+	fields, err := compatFields(s, 4)
+	if err != nil {
+		return err
+	}
+
+	*ge = GroupEntry{Name: fields[0], Password: fields[1]}
+	if ge.GID, ge.HasGID, err = optInt(fields[2]); err != nil {
+		*ge = GroupEntry{}
+		return fieldError(groupFields, 2, ErrNotANumber)
+	}
+	ge.UserList = strings.FieldsFunc(fields[3], func(c rune) bool { return c == ',' })
+	return nil
+}
+
 // A GroupMap is a complete list of groups that can be written and
 // used by the system.
 type GroupMap struct {
 	lines []*GroupEntry
+	raw   preserved
+
+	// byName and byGID index the entries for lookups.  They are
+	// built on the first lookup and discarded by Del.
+	byName map[string]*GroupEntry
+	byGID  map[int]*GroupEntry
 }
 
 func (gm GroupMap) String() string {
 	out := new(strings.Builder)
 	for _, l := range gm.lines {
-		out.WriteString(l.String())
-		out.WriteRune('\n')
+		gm.raw.write(out, l, l.String())
 	}
-	return out.String()
+	return gm.raw.end(out)
+}
+
+// WriteFile atomically replaces the group database at path with the
+// contents of the map.  The global and per-file locks are held for
+// the duration of the write.
+func (gm *GroupMap) WriteFile(path string) error {
+	return writeLocked(path, []byte(gm.String()), 0644)
 }
 
 // ParseGroupMap loads from the specified reader into a list of
 // GroupEntry.
-func ParseGroupMap(r io.Reader) (*GroupMap, error) {
-	lines := []*GroupEntry{}
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
+func ParseGroupMap(r io.Reader, opts ...ParseOption) (*GroupMap, error) {
+	gm := &GroupMap{lines: []*GroupEntry{}}
+	err := parseLines(r, opts, &gm.raw, func(s string) (fmt.Stringer, error) {
 		t := new(GroupEntry)
-		if err := t.Parse(scanner.Text()); err != nil {
+		if err := t.Parse(s); err != nil {
 			return nil, err
 		}
-		lines = append(lines, t)
+		gm.lines = append(gm.lines, t)
+		return t, nil
+	})
+	if !keepMap(err) {
+		return nil, err
 	}
-	gm := new(GroupMap)
-	gm.lines = lines
-	return gm, nil
+	return gm, err
 }
 
-// FilterGID applies a NumericFilter to the UID field of all loaded
+// FilterGID applies a NumericFilter to the GID field of all loaded
 // GroupEntry's and returns a list of all entries that matched.
-func (gm *GroupMap) FilterGID(f NumericFilter) []*GroupEntry {
+// Compat entries are skipped unless IncludeCompat is given.
+func (gm *GroupMap) FilterGID(f NumericFilter, opts ...FilterOption) []*GroupEntry {
+	return gm.Filter(GroupGID(f), opts...)
+}
+
+// Filter applies a GroupFilter to all loaded GroupEntry's and returns
+// a list of all entries that matched.  Compat entries are skipped
+// unless IncludeCompat is given.
+func (gm *GroupMap) Filter(f GroupFilter, opts ...FilterOption) []*GroupEntry {
+	o := newFilterOptions(opts)
 	ng := []*GroupEntry{}
 	for _, l := range gm.lines {
-		if !f(l.GID) {
+		if o.skip(l.Compat()) || !f(l) {
 			// Filter did not match.
 			continue
 		}
@@ -95,6 +154,9 @@ func (gm *GroupMap) FilterGID(f NumericFilter) []*GroupEntry {
 // enforced.
 func (gm *GroupMap) Add(a []*GroupEntry) {
 	gm.lines = append(gm.lines, a...)
+	if gm.byName != nil {
+		gm.indexEntries(a)
+	}
 }
 
 // Del iterates through the provided list and removes entities that
@@ -114,11 +176,72 @@ func (gm *GroupMap) Del(d []*GroupEntry) {
 		if doTest && l.Name == e.Name && l.GID == e.GID {
 			// The entity is a match and should be
 			// removed.
+			gm.raw.drop(l)
 			continue
 		}
 		// The entity is not an exact match, and should be
 		// retained.
+		gm.raw.keep(l)
 		out = append(out, l)
 	}
+	gm.raw.flush()
 	gm.lines = out
+	gm.Reindex()
+}
+
+// LookupName returns the group called name, or nil if there isn't
+// one.  Compat entries are never returned.  Reindex must be called
+// after changing the name or GID of an entry in place, or lookups of
+// the new value will not find it.
+func (gm *GroupMap) LookupName(name string) *GroupEntry {
+	if ge := gm.index().byName[name]; ge == nil || ge.Name == name {
+		return ge
+	}
+	// The entry was renamed since the index was built.
+	gm.Reindex()
+	return gm.index().byName[name]
+}
+
+// LookupGID returns the first group with the given GID, or nil if
+// there isn't one.  Compat entries are never returned.
+func (gm *GroupMap) LookupGID(gid int) *GroupEntry {
+	if ge := gm.index().byGID[gid]; ge == nil || ge.GID == gid {
+		return ge
+	}
+	gm.Reindex()
+	return gm.index().byGID[gid]
+}
+
+// index builds the indexes if they are not already built.
+func (gm *GroupMap) index() *GroupMap {
+	if gm.byName == nil {
+		gm.byName = make(map[string]*GroupEntry, len(gm.lines))
+		gm.byGID = make(map[int]*GroupEntry, len(gm.lines))
+		gm.indexEntries(gm.lines)
+	}
+	return gm
+}
+
+// indexEntries adds entries to the indexes, keeping any existing
+// entry with the same key as it comes first.
+func (gm *GroupMap) indexEntries(entries []*GroupEntry) {
+	for _, l := range entries {
+		if l.Compat() != CompatNone {
+			continue
+		}
+		if _, ok := gm.byName[l.Name]; !ok {
+			gm.byName[l.Name] = l
+		}
+		if _, ok := gm.byGID[l.GID]; !ok {
+			gm.byGID[l.GID] = l
+		}
+	}
+}
+
+// Reindex discards the lookup indexes, which are rebuilt by the next
+// lookup.  It must be called after the name or GID of an entry is
+// changed in place.
+func (gm *GroupMap) Reindex() {
+	gm.byName = nil
+	gm.byGID = nil
 }
@@ -1,6 +1,7 @@
 package shadow
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -45,7 +46,7 @@ func TestParseGroupEntry(t *testing.T) {
 
 	for i, c := range cases {
 		ge := new(GroupEntry)
-		if err := ge.Parse(c.line); err != c.wantErr {
+		if err := ge.Parse(c.line); !errors.Is(err, c.wantErr) {
 			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
 		}
 		if ge.Name != c.wantName {
@@ -97,7 +98,7 @@ func TestParseGroupMap(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		if _, err := ParseGroupMap(c.r); err != c.wantErr {
+		if _, err := ParseGroupMap(c.r); !errors.Is(err, c.wantErr) {
 			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
 		}
 	}
@@ -159,3 +160,41 @@ func TestGroupDel(t *testing.T) {
 		t.Error("Incorrect delete")
 	}
 }
+
+func TestGroupLookup(t *testing.T) {
+	gm, err := ParseGroupMap(strings.NewReader("root:x:0:\nwheel:x:10:maldridge\n+\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ge := gm.LookupName("wheel"); ge == nil || ge.GID != 10 {
+		t.Errorf("Got %v", ge)
+	}
+	if ge := gm.LookupGID(0); ge == nil || ge.Name != "root" {
+		t.Errorf("Got %v", ge)
+	}
+	if ge := gm.LookupName("+"); ge != nil {
+		t.Errorf("Got compat entry %v", ge)
+	}
+
+	gm.Add([]*GroupEntry{{Name: "users", GID: 100}})
+	if ge := gm.LookupGID(100); ge == nil || ge.Name != "users" {
+		t.Errorf("Got %v after Add", ge)
+	}
+	gm.Del([]*GroupEntry{{Name: "wheel", GID: 10}})
+	if ge := gm.LookupName("wheel"); ge != nil {
+		t.Errorf("Got %v after Del", ge)
+	}
+
+	// Keys changed in place are found once reindexed.
+	gm.LookupName("users").Name = "staff"
+	gm.Reindex()
+	if ge := gm.LookupName("staff"); ge == nil || ge.GID != 100 {
+		t.Errorf("Got %v after rename", ge)
+	}
+	gm.LookupGID(100).GID = 50
+	gm.Reindex()
+	if ge := gm.LookupGID(50); ge == nil || ge.Name != "staff" {
+		t.Errorf("Got %v after changing the GID", ge)
+	}
+}
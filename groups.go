@@ -0,0 +1,291 @@
+package shadow
+
+// A NewGroup describes a group to be created with AddGroup.  Only
+// Name is required.
+type NewGroup struct {
+	Name string
+
+	// Password is the already hashed group password.  If it is
+	// empty the group password is locked, so only members may
+	// switch to the group.
+	Password string
+
+	// GID is only used if HasGID is set, otherwise a free GID is
+	// allocated from the system or regular range depending on
+	// System.
+	GID    int
+	HasGID bool
+	System bool
+
+	Members        []string
+	Administrators []string
+}
+
+// A GroupMod describes changes to make to an existing group with
+// ModifyGroup.  Fields left nil are not changed.
+type GroupMod struct {
+	Name     *string
+	GID      *int
+	Password *string
+}
+
+// AddGroup creates a new group in the same way as groupadd(8).  The
+// group is added to both group and gshadow, and the new group entry
+// is returned.  As with AddUser, the entry must pass Validate and
+// the name must be allowed by NameRules.
+func (db *DB) AddGroup(g NewGroup) (*GroupEntry, error) {
+	check := &GroupEntry{Name: g.Name, Password: g.Password, GID: g.GID}
+	if err := check.Validate(db.validateOptions()...); err != nil {
+		return nil, err
+	}
+	if err := db.checkNewName(g.Name); err != nil {
+		return nil, err
+	}
+	if db.Group.LookupName(g.Name) != nil {
+		return nil, ErrGroupExists
+	}
+	if db.GShadow != nil && db.GShadow.find(g.Name) != nil {
+		return nil, ErrGroupExists
+	}
+	for _, m := range append(append([]string{}, g.Members...), g.Administrators...) {
+		if db.Passwd.LookupLogin(m) == nil {
+			return nil, ErrNoSuchUser
+		}
+	}
+
+	gid := g.GID
+	if g.HasGID {
+		if db.Group.LookupGID(gid) != nil {
+			return nil, ErrIDInUse
+		}
+	} else {
+		var err error
+		if gid, err = db.allocator().NextGID(db.Group, g.System); err != nil {
+			return nil, err
+		}
+	}
+
+	password := g.Password
+	if password == "" {
+		password = "!"
+	}
+
+	ge := &GroupEntry{
+		Name:     g.Name,
+		GID:      gid,
+		UserList: append([]string{}, g.Members...),
+	}
+	if db.GShadow != nil {
+		ge.Password = "x"
+		db.GShadow.Add([]*GShadowEntry{&GShadowEntry{
+			Name:           g.Name,
+			Password:       password,
+			Administrators: append([]string{}, g.Administrators...),
+			Members:        append([]string{}, g.Members...),
+		}})
+	} else {
+		ge.Password = password
+	}
+	db.Group.Add([]*GroupEntry{ge})
+	return ge, nil
+}
+
+// ModifyGroup changes an existing group in the same way as
+// groupmod(8).  A renamed group is renamed in gshadow as well, and
+// changing the GID moves every user whose primary group it was to
+// the new GID.  The changed entry must pass Validate, and a new
+// name must be allowed by NameRules.
+func (db *DB) ModifyGroup(name string, m GroupMod) error {
+	ge := db.Group.LookupName(name)
+	if ge == nil {
+		return ErrNoSuchGroup
+	}
+	if m.Name != nil && *m.Name != name {
+		if db.Group.LookupName(*m.Name) != nil {
+			return ErrGroupExists
+		}
+		if db.GShadow != nil && db.GShadow.find(*m.Name) != nil {
+			return ErrGroupExists
+		}
+	}
+	if m.GID != nil && *m.GID != ge.GID && db.Group.LookupGID(*m.GID) != nil {
+		return ErrIDInUse
+	}
+
+	check := *ge
+	if m.Name != nil {
+		check.Name = *m.Name
+	}
+	if m.GID != nil {
+		check.GID = *m.GID
+	}
+	if m.Password != nil {
+		check.Password = *m.Password
+	}
+	if err := check.Validate(db.validateOptions()...); err != nil {
+		return err
+	}
+	if m.Name != nil && *m.Name != name {
+		if err := db.checkNewName(*m.Name); err != nil {
+			return err
+		}
+	}
+
+	var gse *GShadowEntry
+	if db.GShadow != nil {
+		gse = db.GShadow.find(name)
+	}
+
+	if m.Name != nil {
+		ge.Name = *m.Name
+		if gse != nil {
+			gse.Name = *m.Name
+		}
+		db.Group.Reindex()
+	}
+	if m.GID != nil && *m.GID != ge.GID {
+		for _, l := range db.Passwd.lines {
+			if l.Compat() == CompatNone && l.GID == ge.GID {
+				l.GID = *m.GID
+			}
+		}
+		ge.GID = *m.GID
+		db.Group.Reindex()
+	}
+	if m.Password != nil {
+		if gse != nil {
+			gse.Password = *m.Password
+		} else {
+			ge.Password = *m.Password
+		}
+	}
+	return nil
+}
+
+// DeleteGroup removes a group in the same way as groupdel(8).  A
+// group which is still the primary group of a user will not be
+// removed unless force is set, in which case those users are left
+// with a primary GID that no longer names a group.
+func (db *DB) DeleteGroup(name string, force bool) error {
+	ge := db.Group.LookupName(name)
+	if ge == nil {
+		return ErrNoSuchGroup
+	}
+	if !force {
+		for _, l := range db.Passwd.lines {
+			if l.Compat() == CompatNone && l.GID == ge.GID {
+				return ErrGroupInUse
+			}
+		}
+	}
+
+	db.Group.Del([]*GroupEntry{ge})
+	if db.GShadow != nil {
+		if gse := db.GShadow.find(name); gse != nil {
+			db.GShadow.Del([]*GShadowEntry{gse})
+		}
+	}
+	return nil
+}
+
+// AddMember adds an existing user to a group in the same way as
+// `gpasswd -a`.  Adding a user that is already a member does
+// nothing.
+func (db *DB) AddMember(group, login string) error {
+	ge := db.Group.LookupName(group)
+	if ge == nil {
+		return ErrNoSuchGroup
+	}
+	if db.Passwd.LookupLogin(login) == nil {
+		return ErrNoSuchUser
+	}
+	db.addMember(ge, login)
+	return nil
+}
+
+// RemoveMember removes a user from a group in the same way as
+// `gpasswd -d`.
+func (db *DB) RemoveMember(group, login string) error {
+	ge := db.Group.LookupName(group)
+	if ge == nil {
+		return ErrNoSuchGroup
+	}
+	if !contains(ge.UserList, login) {
+		return ErrNoSuchUser
+	}
+	db.removeMember(ge, login)
+	return nil
+}
+
+// SetAdministrators replaces the administrators of a group in the
+// same way as `gpasswd -A`.  Administrators are only recorded in
+// gshadow, so this does nothing on systems without one.
+func (db *DB) SetAdministrators(group string, admins []string) error {
+	if db.Group.LookupName(group) == nil {
+		return ErrNoSuchGroup
+	}
+	for _, a := range admins {
+		if db.Passwd.LookupLogin(a) == nil {
+			return ErrNoSuchUser
+		}
+	}
+	if db.GShadow == nil {
+		return nil
+	}
+	gse := db.GShadow.find(group)
+	if gse == nil {
+		gse = &GShadowEntry{Name: group, Password: "!"}
+		db.GShadow.Add([]*GShadowEntry{gse})
+	}
+	gse.Administrators = append([]string{}, admins...)
+	return nil
+}
+
+// GroupsOf returns every group login belongs to, in the order
+// getgrouplist(3) reports them: the primary group first, followed by
+// the groups listing the user as a member in the order they appear
+// in the group database.  Each GID is only reported once, and a
+// primary GID without a group entry is left out.
+func (db *DB) GroupsOf(login string) ([]*GroupEntry, error) {
+	pe := db.Passwd.LookupLogin(login)
+	if pe == nil {
+		return nil, ErrNoSuchUser
+	}
+
+	out := []*GroupEntry{}
+	seen := make(map[int]bool)
+	if ge := db.Group.LookupGID(pe.GID); ge != nil {
+		out = append(out, ge)
+	}
+	seen[pe.GID] = true
+	for _, ge := range db.Group.lines {
+		if ge.Compat() != CompatNone || seen[ge.GID] || !contains(ge.UserList, login) {
+			continue
+		}
+		out = append(out, ge)
+		seen[ge.GID] = true
+	}
+	return out, nil
+}
+
+// MembersOf returns every user that belongs to group, either because
+// it is their primary group or because they are listed as a member.
+// Users are returned in the order they appear in the passwd
+// database, and listed members without a passwd entry are left out.
+func (db *DB) MembersOf(group string) ([]*PasswdEntry, error) {
+	ge := db.Group.LookupName(group)
+	if ge == nil {
+		return nil, ErrNoSuchGroup
+	}
+
+	out := []*PasswdEntry{}
+	for _, pe := range db.Passwd.lines {
+		if pe.Compat() != CompatNone {
+			continue
+		}
+		if pe.GID == ge.GID || contains(ge.UserList, pe.Login) {
+			out = append(out, pe)
+		}
+	}
+	return out, nil
+}
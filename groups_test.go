@@ -0,0 +1,182 @@
+package shadow
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddGroup(t *testing.T) {
+	db := newTestDB(t)
+
+	ge, err := db.AddGroup(NewGroup{Name: "kvm", Members: []string{"maldridge"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ge.GID != 1001 || ge.Password != "x" || !contains(ge.UserList, "maldridge") {
+		t.Errorf("Bad entry: %v", ge)
+	}
+	if gse := db.GShadow.find("kvm"); gse == nil || gse.Password != "!" || !contains(gse.Members, "maldridge") {
+		t.Errorf("Bad gshadow entry: %v", gse)
+	}
+	if err := db.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := db.AddGroup(NewGroup{Name: "kvm"}); err != ErrGroupExists {
+		t.Errorf("Got %v; Want %v", err, ErrGroupExists)
+	}
+	if _, err := db.AddGroup(NewGroup{Name: "x", GID: 10, HasGID: true}); err != ErrIDInUse {
+		t.Errorf("Got %v; Want %v", err, ErrIDInUse)
+	}
+	if _, err := db.AddGroup(NewGroup{Name: "x", Members: []string{"nobody"}}); err != ErrNoSuchUser {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchUser)
+	}
+}
+
+func TestAddGroupInvalid(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.AddGroup(NewGroup{Name: "kvm", Password: "a:b"}); !errors.Is(err, ErrInvalidCharacter) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidCharacter)
+	}
+	if _, err := db.AddGroup(NewGroup{Name: "a,b"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidName)
+	}
+
+	name := "a:b"
+	if err := db.ModifyGroup("wheel", GroupMod{Name: &name}); !errors.Is(err, ErrInvalidCharacter) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidCharacter)
+	}
+	if db.Group.LookupName("wheel") == nil {
+		t.Error("Invalid change applied")
+	}
+}
+
+func TestModifyGroup(t *testing.T) {
+	db := newTestDB(t)
+
+	name := "mal"
+	gid := 2000
+	if err := db.ModifyGroup("maldridge", GroupMod{Name: &name, GID: &gid}); err != nil {
+		t.Fatal(err)
+	}
+	if ge := db.Group.LookupName("mal"); ge == nil || ge.GID != 2000 {
+		t.Errorf("Bad entry: %v", ge)
+	}
+	if db.GShadow.find("mal") == nil {
+		t.Error("gshadow not renamed")
+	}
+	if pe := db.Passwd.LookupLogin("maldridge"); pe.GID != 2000 {
+		t.Errorf("Primary GID not moved: %v", pe)
+	}
+
+	wheel := "wheel"
+	if err := db.ModifyGroup("mal", GroupMod{Name: &wheel}); err != ErrGroupExists {
+		t.Errorf("Got %v; Want %v", err, ErrGroupExists)
+	}
+
+	// An orphaned gshadow entry also blocks the rename.
+	orphan := "orphan"
+	db.GShadow.Add([]*GShadowEntry{&GShadowEntry{Name: orphan, Password: "!"}})
+	if err := db.ModifyGroup("mal", GroupMod{Name: &orphan}); err != ErrGroupExists {
+		t.Errorf("Got %v; Want %v", err, ErrGroupExists)
+	}
+	if db.Group.LookupName("mal") == nil {
+		t.Error("Failed rename changed the group")
+	}
+}
+
+func TestDeleteGroup(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.DeleteGroup("maldridge", false); err != ErrGroupInUse {
+		t.Errorf("Got %v; Want %v", err, ErrGroupInUse)
+	}
+	if err := db.DeleteGroup("wheel", false); err != nil {
+		t.Fatal(err)
+	}
+	if db.Group.LookupName("wheel") != nil || db.GShadow.find("wheel") != nil {
+		t.Error("Group not removed")
+	}
+	if err := db.DeleteGroup("maldridge", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteGroup("wheel", false); err != ErrNoSuchGroup {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchGroup)
+	}
+}
+
+func TestGroupMembers(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.AddMember("root", "maldridge"); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(db.Group.LookupName("root").UserList, "maldridge") ||
+		!contains(db.GShadow.find("root").Members, "maldridge") {
+		t.Error("Member not added")
+	}
+	if err := db.RemoveMember("wheel", "maldridge"); err != nil {
+		t.Fatal(err)
+	}
+	if contains(db.Group.LookupName("wheel").UserList, "maldridge") ||
+		contains(db.GShadow.find("wheel").Members, "maldridge") {
+		t.Error("Member not removed")
+	}
+	if err := db.AddMember("root", "nobody"); err != ErrNoSuchUser {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchUser)
+	}
+	if err := db.SetAdministrators("root", []string{"maldridge"}); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(db.GShadow.find("root").Administrators, "maldridge") {
+		t.Error("Administrators not set")
+	}
+}
+
+func TestGroupsOf(t *testing.T) {
+	db := newTestDB(t)
+	db.Group.Add([]*GroupEntry{
+		{Name: "users", GID: 100, UserList: []string{"root", "maldridge"}},
+		{Name: "self", GID: 1000, UserList: []string{"maldridge"}},
+		{Name: "audio", GID: 63, UserList: []string{"maldridge"}},
+	})
+
+	got, err := db.GroupsOf("maldridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"maldridge", "wheel", "users", "audio"}
+	if len(got) != len(want) {
+		t.Fatalf("Got %v; Want %v", got, want)
+	}
+	for i, w := range want {
+		if got[i].Name != w {
+			t.Errorf("%d: Got %s; Want %s", i, got[i].Name, w)
+		}
+	}
+
+	if _, err := db.GroupsOf("nobody"); err != ErrNoSuchUser {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchUser)
+	}
+}
+
+func TestMembersOf(t *testing.T) {
+	db := newTestDB(t)
+	db.Passwd.Add([]*PasswdEntry{{Login: "other", UID: 1001, GID: 10}})
+	db.Group.LookupName("wheel").UserList = append(db.Group.LookupName("wheel").UserList, "ghost")
+
+	got, err := db.MembersOf("wheel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Login != "maldridge" || got[1].Login != "other" {
+		t.Errorf("Got %v", got)
+	}
+
+	if got, _ := db.MembersOf("root"); len(got) != 1 || got[0].Login != "root" {
+		t.Errorf("Got %v", got)
+	}
+	if _, err := db.MembersOf("nogroup"); err != ErrNoSuchGroup {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchGroup)
+	}
+}
@@ -0,0 +1,139 @@
+package shadow
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A GShadowEntry is a single entry in the gshadow database.  The
+// entry uses the field names as found in `man 5 gshadow`.
+type GShadowEntry struct {
+	Name           string
+	Password       string
+	Administrators []string
+	Members        []string
+}
+
+func (gse GShadowEntry) String() string {
+	return gse.Name + ":" +
+		gse.Password + ":" +
+		strings.Join(gse.Administrators, ",") + ":" +
+		strings.Join(gse.Members, ",")
+}
+
+// Parse reads a single entry of the gshadow database.
+func (gse *GShadowEntry) Parse(s string) error {
+	fields := strings.Split(s, ":")
+	if len(fields) != 4 {
+		return recordError(ErrWrongNumFields)
+	}
+
+	splitList := func(c rune) bool { return c == ',' }
+
+	gse.Name = fields[0]
+	gse.Password = fields[1]
+	gse.Administrators = strings.FieldsFunc(fields[2], splitList)
+	gse.Members = strings.FieldsFunc(fields[3], splitList)
+	return nil
+}
+
+// A GShadowMap is a complete set of gshadow entries that holds the
+// secret parts of the group database.
+type GShadowMap struct {
+	lines []*GShadowEntry
+	raw   preserved
+}
+
+func (gsm GShadowMap) String() string {
+	out := new(strings.Builder)
+	for _, l := range gsm.lines {
+		gsm.raw.write(out, l, l.String())
+	}
+	return gsm.raw.end(out)
+}
+
+// WriteFile atomically replaces the gshadow database at path with the
+// contents of the map.  The global and per-file locks are held for
+// the duration of the write.
+func (gsm *GShadowMap) WriteFile(path string) error {
+	return writeLocked(path, []byte(gsm.String()), 0640)
+}
+
+// ParseGShadowMap loads from the specified reader into a list of
+// GShadowEntry.
+func ParseGShadowMap(r io.Reader, opts ...ParseOption) (*GShadowMap, error) {
+	gsm := &GShadowMap{lines: []*GShadowEntry{}}
+	err := parseLines(r, opts, &gsm.raw, func(s string) (fmt.Stringer, error) {
+		t := new(GShadowEntry)
+		if err := t.Parse(s); err != nil {
+			return nil, err
+		}
+		gsm.lines = append(gsm.lines, t)
+		return t, nil
+	})
+	if !keepMap(err) {
+		return nil, err
+	}
+	return gsm, err
+}
+
+// FilterName applies a StringFilter to the Name field of all loaded
+// GShadowEntry's and returns a list of all entries that matched.
+func (gsm *GShadowMap) FilterName(f StringFilter) []*GShadowEntry {
+	ng := []*GShadowEntry{}
+	for _, l := range gsm.lines {
+		if !f(l.Name) {
+			// Filter did not match.
+			continue
+		}
+		ng = append(ng, l)
+	}
+	return ng
+}
+
+// Add adds new gshadow entries to the existing map.  Uniqueness is
+// not enforced.
+func (gsm *GShadowMap) Add(a []*GShadowEntry) {
+	gsm.lines = append(gsm.lines, a...)
+}
+
+// Del iterates through the provided list and removes entities that
+// match by Name and Password from the existing map.  The provided set
+// must not contain duplicate Name values, potentially necessitating
+// two calls if you have entries that are identical except for name.
+func (gsm *GShadowMap) Del(d []*GShadowEntry) {
+	checkMap := make(map[string]*GShadowEntry, len(d))
+
+	for _, e := range d {
+		checkMap[e.Name] = e
+	}
+
+	out := []*GShadowEntry{}
+	for _, l := range gsm.lines {
+		e, doTest := checkMap[l.Name]
+		if doTest && l.Name == e.Name && l.Password == e.Password {
+			// The entity is a match and should be
+			// removed.
+			gsm.raw.drop(l)
+			continue
+		}
+		// The entity is not an exact match, and should be
+		// retained.
+		gsm.raw.keep(l)
+		out = append(out, l)
+	}
+	gsm.raw.flush()
+	gsm.lines = out
+}
+
+// find returns the entry for the group called name, or nil if there
+// isn't one.
+func (gsm *GShadowMap) find(name string) *GShadowEntry {
+	for _, l := range gsm.lines {
+		if l.Name == name {
+			return l
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package shadow
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestGShadowEntryString(t *testing.T) {
+	x := GShadowEntry{
+		Name:           "group",
+		Password:       "!",
+		Administrators: []string{"root"},
+		Members:        []string{"foo", "bar"},
+	}
+
+	want := "group:!:root:foo,bar"
+	if x.String() != want {
+		t.Errorf("Got: '%s'; Want: '%s'", x.String(), want)
+	}
+}
+
+func TestParseGShadowEntry(t *testing.T) {
+	cases := []struct {
+		line        string
+		wantErr     error
+		wantName    string
+		wantAdmins  int
+		wantMembers int
+	}{
+		{
+			line:     "",
+			wantErr:  ErrWrongNumFields,
+			wantName: "",
+		},
+		{
+			line:        "kvm:!::maldridge,libvirt",
+			wantErr:     nil,
+			wantName:    "kvm",
+			wantAdmins:  0,
+			wantMembers: 2,
+		},
+		{
+			line:        "wheel:!:root:",
+			wantErr:     nil,
+			wantName:    "wheel",
+			wantAdmins:  1,
+			wantMembers: 0,
+		},
+	}
+
+	for i, c := range cases {
+		gse := new(GShadowEntry)
+		if err := gse.Parse(c.line); !errors.Is(err, c.wantErr) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if gse.Name != c.wantName {
+			t.Errorf("%d: Got Name %s; Want name %s", i, gse.Name, c.wantName)
+		}
+		if len(gse.Administrators) != c.wantAdmins {
+			t.Errorf("%d: Got %d admins; Want %d", i, len(gse.Administrators), c.wantAdmins)
+		}
+		if len(gse.Members) != c.wantMembers {
+			t.Errorf("%d: Got %d members; Want %d", i, len(gse.Members), c.wantMembers)
+		}
+	}
+}
+
+func TestGShadowMapString(t *testing.T) {
+	x := GShadowMap{
+		lines: []*GShadowEntry{
+			&GShadowEntry{
+				Name:     "group",
+				Password: "!",
+				Members:  []string{"foo", "bar"},
+			},
+			&GShadowEntry{
+				Name:           "ungroup",
+				Password:       "*",
+				Administrators: []string{"baz"},
+			},
+		},
+	}
+
+	want := "group:!::foo,bar\nungroup:*:baz:\n"
+	if x.String() != want {
+		t.Errorf("Got: '%s'; Want: '%s'", x.String(), want)
+	}
+}
+
+func TestParseGShadowMap(t *testing.T) {
+	cases := []struct {
+		r       io.Reader
+		wantErr error
+	}{
+		{
+			r:       strings.NewReader("\nplaceholder\n"),
+			wantErr: ErrWrongNumFields,
+		},
+		{
+			r:       strings.NewReader("kvm:!::maldridge,libvirt"),
+			wantErr: nil,
+		},
+		{
+			r:       strings.NewReader("kvm:!::"),
+			wantErr: nil,
+		},
+	}
+	for i, c := range cases {
+		if _, err := ParseGShadowMap(c.r); !errors.Is(err, c.wantErr) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestFilterGShadowName(t *testing.T) {
+	gsm := &GShadowMap{
+		lines: []*GShadowEntry{
+			&GShadowEntry{
+				Name: "group1",
+			},
+			&GShadowEntry{
+				Name: "group2",
+			},
+		},
+	}
+
+	res := gsm.FilterName(func(s string) bool { return s == "group2" })
+	if len(res) != 1 || res[0].Name != "group2" {
+		t.Error("Filter applied incorrectly!")
+	}
+}
+
+func TestGShadowAdd(t *testing.T) {
+	gsm := &GShadowMap{
+		lines: []*GShadowEntry{},
+	}
+
+	if len(gsm.lines) > 0 {
+		t.Error("Wrong base condition")
+	}
+
+	gsm.Add([]*GShadowEntry{&GShadowEntry{Name: "foo"}})
+
+	if len(gsm.lines) != 1 {
+		t.Error("Add failed")
+	}
+}
+
+func TestGShadowDel(t *testing.T) {
+	gsm := &GShadowMap{
+		lines: []*GShadowEntry{
+			&GShadowEntry{
+				Name:     "group1",
+				Password: "!",
+			},
+			&GShadowEntry{
+				Name:     "group2",
+				Password: "!",
+			},
+		},
+	}
+
+	gsm.Del([]*GShadowEntry{&GShadowEntry{Name: "group1", Password: "!"}})
+	if len(gsm.lines) != 1 || gsm.lines[0].Name != "group2" {
+		t.Logf("%v", gsm.lines)
+		t.Error("Incorrect delete")
+	}
+}
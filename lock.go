@@ -0,0 +1,128 @@
+package shadow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These are the default locations of the account databases and the
+// global lock file that guards them.
+const (
+	PasswdFile  = "/etc/passwd"
+	ShadowFile  = "/etc/shadow"
+	GroupFile   = "/etc/group"
+	GShadowFile = "/etc/gshadow"
+	SubUIDFile  = "/etc/subuid"
+	SubGIDFile  = "/etc/subgid"
+	PwdLockFile = "/etc/.pwd.lock"
+)
+
+// LockTimeout is how long AcquireLock will wait for the global lock
+// before giving up.  The default matches lckpwdf(3).
+var LockTimeout = 15 * time.Second
+
+// A Lock is held over the account databases while they are being
+// modified.  It consists of the global lock used by lckpwdf(3) and
+// the per-file lock files used by shadow-utils.
+type Lock struct {
+	global *os.File
+	files  []string
+}
+
+// AcquireLock obtains the global lock at pwdLock and then a per-file
+// lock for each of the named databases.  The per-file locks are
+// created as `<file>.lock` containing the pid of the holder, which is
+// the same convention that vipw, useradd and friends follow.  If any
+// lock cannot be obtained all locks taken so far are released.
+func AcquireLock(pwdLock string, dbs ...string) (*Lock, error) {
+	global, err := lockGlobal(pwdLock, LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lock{global: global}
+	for _, db := range dbs {
+		if err := lockFile(db); err != nil {
+			l.Release()
+			return nil, err
+		}
+		l.files = append(l.files, db)
+	}
+	return l, nil
+}
+
+// Release drops all locks held.  The first error encountered is
+// returned, but all locks will be released regardless.
+func (l *Lock) Release() error {
+	var firstErr error
+	for i := len(l.files) - 1; i >= 0; i-- {
+		if err := os.Remove(l.files[i] + ".lock"); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.files = nil
+
+	if l.global != nil {
+		if err := l.global.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		l.global = nil
+	}
+	return firstErr
+}
+
+// lockFile creates the shadow-utils style lock for path.  A file
+// named with our pid is written and then hard linked into place,
+// which is atomic even on NFS.  Stale locks left behind by dead
+// processes are cleaned up.
+func lockFile(path string) error {
+	pid := os.Getpid()
+	tmp := path + "." + strconv.Itoa(pid)
+	lock := path + ".lock"
+
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(pid)), 0600); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	for tries := 0; tries < 2; tries++ {
+		err := os.Link(tmp, lock)
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		// Someone else has the lock, check if they're still
+		// around to hold it.
+		b, err := ioutil.ReadFile(lock)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		holder, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || holder <= 0 {
+			return ErrLocked
+		}
+		if holder == pid || processAlive(holder) {
+			return ErrLocked
+		}
+		if err := os.Remove(lock); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return ErrLocked
+}
+
+// lockPathFor returns the global lock that guards a database at
+// path.  The lock is expected to live beside the database.
+func lockPathFor(path string) string {
+	return filepath.Join(filepath.Dir(path), filepath.Base(PwdLockFile))
+}
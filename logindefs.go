@@ -0,0 +1,227 @@
+package shadow
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoginDefsFile is the default location of the shadow-utils
+// configuration file.
+const LoginDefsFile = "/etc/login.defs"
+
+// loginDefsDefaults holds the values that shadow-utils falls back to
+// when a key is absent from login.defs.  Keys whose fallback depends
+// on other keys are handled by the typed accessors.
+var loginDefsDefaults = map[string]string{
+	"PASS_MAX_DAYS":   "-1",
+	"PASS_MIN_DAYS":   "-1",
+	"PASS_WARN_AGE":   "-1",
+	"UID_MIN":         "1000",
+	"UID_MAX":         "60000",
+	"SYS_UID_MIN":     "101",
+	"GID_MIN":         "1000",
+	"GID_MAX":         "60000",
+	"SYS_GID_MIN":     "101",
+	"SUB_UID_MIN":     "100000",
+	"SUB_UID_MAX":     "600100000",
+	"SUB_UID_COUNT":   "65536",
+	"SUB_GID_MIN":     "100000",
+	"SUB_GID_MAX":     "600100000",
+	"SUB_GID_COUNT":   "65536",
+	"USERGROUPS_ENAB": "no",
+	"MD5_CRYPT_ENAB":  "no",
+}
+
+// LoginDefs holds the settings read from login.defs(5).  The zero
+// value and a nil *LoginDefs both behave as an empty file, in which
+// case every accessor returns the shadow-utils default.
+type LoginDefs struct {
+	values map[string]string
+}
+
+// ParseLoginDefs reads login.defs from r.  Each setting is a name and
+// a value separated by whitespace, optionally enclosed in double
+// quotes.  Blank lines and lines beginning with '#' are ignored.
+func ParseLoginDefs(r io.Reader) (*LoginDefs, error) {
+	ld := &LoginDefs{values: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := fields[0]
+		value := ""
+		if len(fields) > 1 {
+			value = strings.TrimSpace(strings.TrimPrefix(line, name))
+			value = strings.Trim(value, "\"")
+		}
+		ld.values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ld, nil
+}
+
+// Lookup returns the value of key and reports if it was set.  Unlike
+// the other accessors it does not fall back to a default.
+func (ld *LoginDefs) Lookup(key string) (string, bool) {
+	if ld == nil {
+		return "", false
+	}
+	v, ok := ld.values[key]
+	return v, ok
+}
+
+// Value returns the value of key, or its default if it is not set.
+func (ld *LoginDefs) Value(key string) string {
+	if v, ok := ld.Lookup(key); ok {
+		return v
+	}
+	return loginDefsDefaults[key]
+}
+
+// Int returns the numeric value of key.  As in shadow-utils the
+// value may be given in decimal, octal with a leading 0, or
+// hexadecimal with a leading 0x.  If the key is unset and has no
+// default, or is not a number, def is returned.
+func (ld *LoginDefs) Int(key string, def int) int {
+	i, err := strconv.ParseInt(ld.Value(key), 0, 64)
+	if err != nil {
+		return def
+	}
+	return int(i)
+}
+
+// Bool returns the boolean value of key, which is true only if the
+// value is "yes" in any case.
+func (ld *LoginDefs) Bool(key string) bool {
+	return strings.EqualFold(ld.Value(key), "yes")
+}
+
+// PassMaxDays returns PASS_MAX_DAYS, or -1 if passwords never need to
+// be changed.
+func (ld *LoginDefs) PassMaxDays() int {
+	return ld.Int("PASS_MAX_DAYS", -1)
+}
+
+// PassMinDays returns PASS_MIN_DAYS, or -1 if unset.
+func (ld *LoginDefs) PassMinDays() int {
+	return ld.Int("PASS_MIN_DAYS", -1)
+}
+
+// PassWarnAge returns PASS_WARN_AGE, or -1 if unset.
+func (ld *LoginDefs) PassWarnAge() int {
+	return ld.Int("PASS_WARN_AGE", -1)
+}
+
+// EncryptMethod returns the method used to hash new passwords, in
+// upper case.  If ENCRYPT_METHOD is unset this is MD5 when
+// MD5_CRYPT_ENAB is on and DES otherwise, just as in shadow-utils.
+func (ld *LoginDefs) EncryptMethod() string {
+	if v, ok := ld.Lookup("ENCRYPT_METHOD"); ok && v != "" {
+		return strings.ToUpper(v)
+	}
+	if ld.Bool("MD5_CRYPT_ENAB") {
+		return "MD5"
+	}
+	return "DES"
+}
+
+// UserGroupsEnab reports if USERGROUPS_ENAB is on.
+func (ld *LoginDefs) UserGroupsEnab() bool {
+	return ld.Bool("USERGROUPS_ENAB")
+}
+
+// UIDRange returns UID_MIN through UID_MAX.
+func (ld *LoginDefs) UIDRange() IDRange {
+	return IDRange{Min: ld.Int("UID_MIN", 1000), Max: ld.Int("UID_MAX", 60000)}
+}
+
+// SysUIDRange returns SYS_UID_MIN through SYS_UID_MAX.  An unset
+// SYS_UID_MAX defaults to one less than UID_MIN.
+func (ld *LoginDefs) SysUIDRange() IDRange {
+	return IDRange{
+		Min: ld.Int("SYS_UID_MIN", 101),
+		Max: ld.Int("SYS_UID_MAX", ld.UIDRange().Min-1),
+	}
+}
+
+// GIDRange returns GID_MIN through GID_MAX.
+func (ld *LoginDefs) GIDRange() IDRange {
+	return IDRange{Min: ld.Int("GID_MIN", 1000), Max: ld.Int("GID_MAX", 60000)}
+}
+
+// SysGIDRange returns SYS_GID_MIN through SYS_GID_MAX.  An unset
+// SYS_GID_MAX defaults to one less than GID_MIN.
+func (ld *LoginDefs) SysGIDRange() IDRange {
+	return IDRange{
+		Min: ld.Int("SYS_GID_MIN", 101),
+		Max: ld.Int("SYS_GID_MAX", ld.GIDRange().Min-1),
+	}
+}
+
+// SubUIDRange returns SUB_UID_MIN through SUB_UID_MAX, the IDs from
+// which subordinate UIDs are handed out.
+func (ld *LoginDefs) SubUIDRange() IDRange {
+	return IDRange{Min: ld.Int("SUB_UID_MIN", 100000), Max: ld.Int("SUB_UID_MAX", 600100000)}
+}
+
+// SubUIDCount returns SUB_UID_COUNT, the number of subordinate UIDs
+// given to each new user.
+func (ld *LoginDefs) SubUIDCount() int {
+	return ld.Int("SUB_UID_COUNT", 65536)
+}
+
+// SubGIDRange returns SUB_GID_MIN through SUB_GID_MAX.
+func (ld *LoginDefs) SubGIDRange() IDRange {
+	return IDRange{Min: ld.Int("SUB_GID_MIN", 100000), Max: ld.Int("SUB_GID_MAX", 600100000)}
+}
+
+// SubGIDCount returns SUB_GID_COUNT.
+func (ld *LoginDefs) SubGIDCount() int {
+	return ld.Int("SUB_GID_COUNT", 65536)
+}
+
+// Allocator returns an Allocator using the ID ranges configured in
+// login.defs.
+func (ld *LoginDefs) Allocator() *Allocator {
+	return &Allocator{
+		UID:    ld.UIDRange(),
+		SysUID: ld.SysUIDRange(),
+		GID:    ld.GIDRange(),
+		SysGID: ld.SysGIDRange(),
+	}
+}
+
+// NewShadowEntry returns the shadow entry that useradd(8) would
+// create for a new user, with the password aging fields set from
+// login.defs and the password last changed at now.  Aging values of
+// -1 are left empty.
+func (ld *LoginDefs) NewShadowEntry(login, password string, now time.Time) *ShadowEntry {
+	se := &ShadowEntry{
+		Login:          login,
+		Password:       password,
+		LastChanged:    dayOf(now),
+		Expiration:     epochStart,
+		HasLastChanged: true,
+	}
+	if v := ld.PassMinDays(); v >= 0 {
+		se.MinimumPasswordAge = v
+		se.HasMinimumPasswordAge = true
+	}
+	if v := ld.PassMaxDays(); v >= 0 {
+		se.MaximumPasswordAge = v
+		se.HasMaximumPasswordAge = true
+	}
+	if v := ld.PassWarnAge(); v >= 0 {
+		se.WarningDays = v
+		se.HasWarningDays = true
+	}
+	return se
+}
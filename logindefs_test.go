@@ -0,0 +1,70 @@
+package shadow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLoginDefs(t *testing.T) {
+	ld, err := ParseLoginDefs(strings.NewReader(`
+# Password aging controls:
+PASS_MAX_DAYS	90
+PASS_MIN_DAYS	0
+UID_MIN			 2000
+SYS_UID_MAX		0x3e7
+UMASK		022
+ENCRYPT_METHOD sha512
+MAIL_DIR	"/var/mail"
+USERGROUPS_ENAB YES
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := ld.PassMaxDays(); v != 90 {
+		t.Errorf("PASS_MAX_DAYS: Got %d; Want 90", v)
+	}
+	if v := ld.PassWarnAge(); v != -1 {
+		t.Errorf("PASS_WARN_AGE: Got %d; Want -1", v)
+	}
+	if v := ld.Int("UMASK", 0); v != 022 {
+		t.Errorf("UMASK: Got %o; Want 22", v)
+	}
+	if v := ld.Value("MAIL_DIR"); v != "/var/mail" {
+		t.Errorf("MAIL_DIR: Got %s; Want /var/mail", v)
+	}
+	if v := ld.EncryptMethod(); v != "SHA512" {
+		t.Errorf("ENCRYPT_METHOD: Got %s; Want SHA512", v)
+	}
+	if !ld.UserGroupsEnab() {
+		t.Error("USERGROUPS_ENAB not enabled")
+	}
+	if r := ld.UIDRange(); r != (IDRange{Min: 2000, Max: 60000}) {
+		t.Errorf("UIDRange: Got %v", r)
+	}
+	if r := ld.SysUIDRange(); r != (IDRange{Min: 101, Max: 999}) {
+		t.Errorf("SysUIDRange: Got %v", r)
+	}
+	if r := ld.SysGIDRange(); r != (IDRange{Min: 101, Max: 999}) {
+		t.Errorf("SysGIDRange: Got %v", r)
+	}
+}
+
+func TestLoginDefsDefaults(t *testing.T) {
+	var ld *LoginDefs
+
+	if ld.EncryptMethod() != "DES" {
+		t.Errorf("Got %s; Want DES", ld.EncryptMethod())
+	}
+	if !reflect.DeepEqual(ld.Allocator(), DefaultAllocator()) {
+		t.Errorf("Got %v; Want %v", ld.Allocator(), DefaultAllocator())
+	}
+
+	se := ld.NewShadowEntry("foo", "!", time.Date(2017, time.December, 18, 13, 0, 0, 0, time.UTC))
+	want := "foo:!:17518::::::"
+	if se.String() != want {
+		t.Errorf("Got '%s'; Want '%s'", se.String(), want)
+	}
+}
@@ -0,0 +1,392 @@
+package shadow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Conflict is a change made on both sides of a three-way merge that
+// could not be combined.  The merged map keeps our side of every
+// conflict.
+type Conflict struct {
+	// File is the database and Entry the login or group name the
+	// conflict is in.
+	File  string
+	Entry string
+
+	// Field is the name of the field both sides changed, or empty
+	// if one side removed an entry that the other changed.
+	Field string
+
+	// Ours and Theirs are the values of the field on either side,
+	// or the whole entry if Field is empty, which is empty on the
+	// side that removed it.
+	Ours   string
+	Theirs string
+
+	Message string
+}
+
+func (c Conflict) String() string {
+	return c.File + ": " + c.Entry + ": " + c.Message
+}
+
+// MergePasswd merges the changes between base and theirs into ours,
+// in the way a configuration management tool merges a new vendor
+// passwd file into a locally modified one.  Entries are matched by
+// login and merged field by field.  The result has the entries of
+// ours in their order, followed by the entries only theirs added.
+// Changes that cannot be combined, and UIDs that the merge gives to
+// more than one user, are returned as conflicts.  Base may be nil if
+// there is no common ancestor.  None of the maps are modified.
+func MergePasswd(base, ours, theirs *PasswdMap) (*PasswdMap, []Conflict) {
+	out := ours.clone()
+	if out == nil {
+		out = &PasswdMap{lines: []*PasswdEntry{}}
+	}
+	m := &merge{file: "passwd", names: passwdFields, set: -1, id: 2}
+	out.setEntries(m.apply(base, out, theirs, &out.raw, func(s string) (fmt.Stringer, error) {
+		e := new(PasswdEntry)
+		return e, e.Parse(s)
+	}))
+	return out, m.conflicts
+}
+
+// MergeShadow merges shadow maps in the same way as MergePasswd.
+// Entries are matched by login.
+func MergeShadow(base, ours, theirs *ShadowMap) (*ShadowMap, []Conflict) {
+	out := ours.clone()
+	if out == nil {
+		out = &ShadowMap{lines: []*ShadowEntry{}}
+	}
+	m := &merge{file: "shadow", names: shadowFields, set: -1, id: -1}
+	out.setEntries(m.apply(base, out, theirs, &out.raw, func(s string) (fmt.Stringer, error) {
+		e := new(ShadowEntry)
+		return e, e.Parse(s)
+	}))
+	return out, m.conflicts
+}
+
+// MergeGroup merges group maps in the same way as MergePasswd.
+// Entries are matched by name.  Member lists are merged as sets, so
+// that members added or removed on either side are added or removed
+// in the result, and never conflict.  GIDs that the merge gives to
+// more than one group are returned as conflicts.
+func MergeGroup(base, ours, theirs *GroupMap) (*GroupMap, []Conflict) {
+	out := ours.clone()
+	if out == nil {
+		out = &GroupMap{lines: []*GroupEntry{}}
+	}
+	m := &merge{file: "group", names: groupFields, set: 3, id: 2}
+	out.setEntries(m.apply(base, out, theirs, &out.raw, func(s string) (fmt.Stringer, error) {
+		e := new(GroupEntry)
+		return e, e.Parse(s)
+	}))
+	return out, m.conflicts
+}
+
+// A recordMap is a database whose entries the merge and diff
+// functions handle as formatted lines.
+type recordMap interface {
+	// entries returns the entries, or nil if the map is nil.
+	entries() []fmt.Stringer
+	String() string
+}
+
+// records returns the formatted entries of m.
+func records(m recordMap) []string {
+	e := m.entries()
+	if e == nil {
+		return nil
+	}
+	r := make([]string, len(e))
+	for i, l := range e {
+		r[i] = l.String()
+	}
+	return r
+}
+
+func (pm *PasswdMap) entries() []fmt.Stringer {
+	if pm == nil {
+		return nil
+	}
+	out := make([]fmt.Stringer, len(pm.lines))
+	for i, l := range pm.lines {
+		out[i] = l
+	}
+	return out
+}
+
+// setEntries replaces the entries with e, which must all be of the
+// type the map holds.
+func (pm *PasswdMap) setEntries(e []fmt.Stringer) {
+	pm.lines = make([]*PasswdEntry, len(e))
+	for i, l := range e {
+		pm.lines[i] = l.(*PasswdEntry)
+	}
+	pm.Reindex()
+}
+
+func (sm *ShadowMap) entries() []fmt.Stringer {
+	if sm == nil {
+		return nil
+	}
+	out := make([]fmt.Stringer, len(sm.lines))
+	for i, l := range sm.lines {
+		out[i] = l
+	}
+	return out
+}
+
+func (sm *ShadowMap) setEntries(e []fmt.Stringer) {
+	sm.lines = make([]*ShadowEntry, len(e))
+	for i, l := range e {
+		sm.lines[i] = l.(*ShadowEntry)
+	}
+	sm.Reindex()
+}
+
+func (gm *GroupMap) entries() []fmt.Stringer {
+	if gm == nil {
+		return nil
+	}
+	out := make([]fmt.Stringer, len(gm.lines))
+	for i, l := range gm.lines {
+		out[i] = l
+	}
+	return out
+}
+
+func (gm *GroupMap) setEntries(e []fmt.Stringer) {
+	gm.lines = make([]*GroupEntry, len(e))
+	for i, l := range e {
+		gm.lines[i] = l.(*GroupEntry)
+	}
+	gm.Reindex()
+}
+
+// merge holds the state of a three-way merge of one database, whose
+// entries are handled as formatted lines.
+type merge struct {
+	file  string
+	names []string
+
+	// set is the index of a comma separated list that is merged as
+	// a set, and id the index of a numeric ID that must be unique,
+	// or -1 if there is none.
+	set int
+	id  int
+
+	conflicts []Conflict
+}
+
+// run merges the entries of base, ours and theirs.  It returns the
+// line each entry of ours becomes, which is empty if it is removed,
+// and the lines of entries to add.  Entries are matched on their
+// first field, and only the first entry with a given key takes part
+// in the merge, any later ones in ours being kept as they are.
+func (m *merge) run(base, ours, theirs []string) ([]string, []string) {
+	b, bIdx := m.split(base)
+	o, oIdx := m.split(ours)
+	t, tIdx := m.split(theirs)
+
+	keep := make([]string, len(ours))
+	for i, of := range o {
+		key := of[0]
+		bi, inBase := bIdx[key]
+		ti, inTheirs := tIdx[key]
+		switch {
+		case oIdx[key] != i:
+			keep[i] = ours[i]
+		case inTheirs && inBase:
+			keep[i] = m.fields(key, b[bi], of, t[ti], ours[i])
+		case inTheirs:
+			keep[i] = m.fields(key, nil, of, t[ti], ours[i])
+		case !inBase:
+			keep[i] = ours[i]
+		case ours[i] == base[bi]:
+			// Removed by them.
+			keep[i] = ""
+		default:
+			m.conflict(key, "", ours[i], "", "changed in ours but removed in theirs")
+			keep[i] = ours[i]
+		}
+	}
+
+	add := []string{}
+	for i, tf := range t {
+		key := tf[0]
+		if _, ok := oIdx[key]; ok || tIdx[key] != i {
+			continue
+		}
+		bi, inBase := bIdx[key]
+		switch {
+		case !inBase:
+			add = append(add, theirs[i])
+		case theirs[i] != base[bi]:
+			m.conflict(key, "", "", theirs[i], "changed in theirs but removed in ours")
+		}
+	}
+
+	if m.id >= 0 {
+		m.checkIDs(keep, add, o, oIdx, t, tIdx)
+	}
+	return keep, add
+}
+
+// apply merges the entries of base, ours and theirs, and returns the
+// entries of the result.  Ours must be a copy that can be modified,
+// whose preserved lines are in raw.  Its entries are reused where the
+// merge leaves them unchanged, and parse is used to create the others
+// from their merged lines.
+func (m *merge) apply(base, ours, theirs recordMap, raw *preserved, parse func(string) (fmt.Stringer, error)) []fmt.Stringer {
+	keep, add := m.run(records(base), records(ours), records(theirs))
+
+	out := []fmt.Stringer{}
+	for i, e := range ours.entries() {
+		if keep[i] == "" {
+			raw.drop(e)
+			continue
+		}
+		if keep[i] != e.String() {
+			if n, err := parse(keep[i]); err == nil {
+				// The preserved lines move to the new entry.
+				raw.drop(e)
+				e = n
+			}
+		}
+		raw.keep(e)
+		out = append(out, e)
+	}
+	raw.flush()
+	for _, s := range add {
+		if e, err := parse(s); err == nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// split splits lines into their fields, padded to the full number of
+// fields as compat entries may leave some out, and indexes the first
+// entry with each key.
+func (m *merge) split(lines []string) ([][]string, map[string]int) {
+	fields := make([][]string, len(lines))
+	idx := make(map[string]int, len(lines))
+	for i, l := range lines {
+		f := strings.Split(l, ":")
+		for len(f) < len(m.names) {
+			f = append(f, "")
+		}
+		fields[i] = f
+		if _, ok := idx[f[0]]; !ok {
+			idx[f[0]] = i
+		}
+	}
+	return fields, idx
+}
+
+// fields merges one entry field by field.  Base is nil if the entry
+// was added on both sides.  The line of ours is returned unchanged if
+// the merge keeps all of its fields.
+func (m *merge) fields(key string, base, ours, theirs []string, line string) string {
+	out := make([]string, len(ours))
+	changed := false
+	for i := range ours {
+		bv := ""
+		if base != nil {
+			bv = base[i]
+		}
+		ov, tv := ours[i], theirs[i]
+		switch {
+		case i == m.set:
+			out[i] = mergeSet(bv, ov, tv)
+		case ov == tv, base != nil && tv == bv:
+			out[i] = ov
+		case base != nil && ov == bv:
+			out[i] = tv
+		default:
+			msg := m.names[i] + " changed on both sides"
+			if m.names[i] != "password" {
+				msg = fmt.Sprintf("%s changed to %q in ours and %q in theirs", m.names[i], ov, tv)
+			}
+			m.conflict(key, m.names[i], ov, tv, msg)
+			out[i] = ov
+		}
+		changed = changed || out[i] != ov
+	}
+	if !changed {
+		return line
+	}
+	return strings.Join(out, ":")
+}
+
+// checkIDs reports IDs that the merge gives to more than one entry,
+// unless the entries already shared it in ours or in theirs.
+func (m *merge) checkIDs(keep, add []string, o [][]string, oIdx map[string]int, t [][]string, tIdx map[string]int) {
+	shared := func(f [][]string, idx map[string]int, a, b, id string) bool {
+		i, ok := idx[a]
+		j, ok2 := idx[b]
+		return ok && ok2 && f[i][m.id] == id && f[j][m.id] == id
+	}
+	value := func(f [][]string, idx map[string]int, key string) string {
+		if i, ok := idx[key]; ok {
+			return f[i][m.id]
+		}
+		return ""
+	}
+
+	owner := make(map[string]string)
+	lines := append(append([]string(nil), keep...), add...)
+	for _, l := range lines {
+		f := strings.Split(l, ":")
+		if l == "" || compatKind(f[0]) != CompatNone || len(f) <= m.id || f[m.id] == "" {
+			continue
+		}
+		key, id := f[0], f[m.id]
+		first, ok := owner[id]
+		if !ok {
+			owner[id] = key
+			continue
+		}
+		if first == key || shared(o, oIdx, first, key, id) || shared(t, tIdx, first, key, id) {
+			continue
+		}
+		m.conflict(key, m.names[m.id], value(o, oIdx, key), value(t, tIdx, key),
+			fmt.Sprintf("%s %s is also used by %s", m.names[m.id], id, first))
+	}
+}
+
+func (m *merge) conflict(key, field, ours, theirs, msg string) {
+	m.conflicts = append(m.conflicts, Conflict{
+		File:    m.file,
+		Entry:   key,
+		Field:   field,
+		Ours:    ours,
+		Theirs:  theirs,
+		Message: msg,
+	})
+}
+
+// mergeSet merges comma separated lists as sets.  Members removed on
+// either side are removed, and members added on either side are
+// added, those of ours first.
+func mergeSet(base, ours, theirs string) string {
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(c rune) bool { return c == ',' })
+	}
+	b, o, t := split(base), split(ours), split(theirs)
+
+	out := []string{}
+	for _, x := range o {
+		if !contains(b, x) || contains(t, x) {
+			out = append(out, x)
+		}
+	}
+	for _, x := range t {
+		if !contains(b, x) && !contains(o, x) {
+			out = append(out, x)
+		}
+	}
+	return strings.Join(out, ",")
+}
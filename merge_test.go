@@ -0,0 +1,96 @@
+package shadow
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergePasswd(t *testing.T) {
+	base, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"daemon:x:1:1::/:/sbin/nologin\n" +
+			"games:x:12:100::/usr/games:/sbin/nologin\n" +
+			"news:x:9:13::/var/spool/news:/sbin/nologin\n"))
+	ours, _ := ParsePasswdMap(strings.NewReader(
+		"# local changes\n" +
+			"root:x:0:0:root:/root:/bin/zsh\n" +
+			"daemon:x:1:1::/:/sbin/nologin\n" +
+			"news:x:9:13:News:/var/spool/news:/sbin/nologin\n" +
+			"maldridge:x:1000:1000::/home/maldridge:/bin/zsh\n" +
+			"build:x:999:999::/var/build:/sbin/nologin\n"))
+	theirs, _ := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:Super User:/root:/bin/bash\n" +
+			"games:x:12:100::/usr/games:/usr/sbin/nologin\n" +
+			"news:x:9:13::/var/spool/news:/usr/sbin/nologin\n" +
+			"systemd-oom:x:999:999::/:/usr/sbin/nologin\n"))
+
+	merged, conflicts := MergePasswd(base, ours, theirs)
+	want := "# local changes\n" +
+		"root:x:0:0:Super User:/root:/bin/zsh\n" +
+		"news:x:9:13:News:/var/spool/news:/usr/sbin/nologin\n" +
+		"maldridge:x:1000:1000::/home/maldridge:/bin/zsh\n" +
+		"build:x:999:999::/var/build:/sbin/nologin\n" +
+		"systemd-oom:x:999:999::/:/usr/sbin/nologin\n"
+	if merged.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", merged, want)
+	}
+
+	wantConflicts := []struct {
+		entry string
+		field string
+	}{
+		{"root", "shell"},
+		{"games", ""},
+		{"systemd-oom", "uid"},
+	}
+	if len(conflicts) != len(wantConflicts) {
+		t.Fatalf("Got %v; Want %d conflicts", conflicts, len(wantConflicts))
+	}
+	for i, w := range wantConflicts {
+		if conflicts[i].Entry != w.entry || conflicts[i].Field != w.field {
+			t.Errorf("%d: Got %v; Want %s %s", i, conflicts[i], w.entry, w.field)
+		}
+	}
+	if c := conflicts[0]; c.Ours != "/bin/zsh" || c.Theirs != "/bin/bash" {
+		t.Errorf("Got %+v", c)
+	}
+
+	// None of the inputs are modified.
+	if ours.LookupLogin("root").Comment != "root" || ours.LookupLogin("daemon") == nil {
+		t.Error("MergePasswd modified ours")
+	}
+}
+
+func TestMergeGroup(t *testing.T) {
+	base, _ := ParseGroupMap(strings.NewReader("wheel:x:10:root,old\naudio:x:63:\n"))
+	ours, _ := ParseGroupMap(strings.NewReader("wheel:x:10:root,old,maldridge\naudio:x:63:maldridge\nlocal:x:1000:\n"))
+	theirs, _ := ParseGroupMap(strings.NewReader("wheel:x:10:root,admin\naudio:x:63:pulse\nvendor:x:1000:\n"))
+
+	merged, conflicts := MergeGroup(base, ours, theirs)
+	want := "wheel:x:10:root,maldridge,admin\naudio:x:63:maldridge,pulse\nlocal:x:1000:\nvendor:x:1000:\n"
+	if merged.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", merged, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].Entry != "vendor" || conflicts[0].Field != "gid" {
+		t.Errorf("Got %v", conflicts)
+	}
+}
+
+func TestMergeShadow(t *testing.T) {
+	ours, _ := ParseShadowMap(strings.NewReader("root:$6$ours:17518:0:99999:7:::\n"))
+	theirs, _ := ParseShadowMap(strings.NewReader("root:$6$theirs:17518:0:99999:7:::\nsshd:!:17518::::::\n"))
+
+	// Without a base, entries added on both sides conflict where
+	// they differ.
+	merged, conflicts := MergeShadow(nil, ours, theirs)
+	want := "root:$6$ours:17518:0:99999:7:::\nsshd:!:17518::::::\n"
+	if merged.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", merged, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].Field != "password" {
+		t.Fatalf("Got %v", conflicts)
+	}
+	if strings.Contains(conflicts[0].String(), "$6$") {
+		t.Errorf("Password hash in conflict message: %s", conflicts[0])
+	}
+}
@@ -0,0 +1,302 @@
+package shadow
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A ParseOption changes how the Parse*Map functions treat their
+// input.
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	lenient bool
+	strict  bool
+
+	// plain is set for databases without a password field, whose
+	// records are quoted in errors as they are.
+	plain bool
+}
+
+func newParseOptions(opts []ParseOption) *parseOptions {
+	o := new(parseOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Lenient continues parsing past records that cannot be parsed.  The
+// offending lines are kept as they are, so that writing the map out
+// again reproduces them, and every problem is reported in a
+// ParseErrors returned alongside the map.
+func Lenient() ParseOption {
+	return func(o *parseOptions) { o.lenient = true }
+}
+
+// Strict validates numeric fields as strictly as shadow-utils does,
+// rather than reading malformed values as 0.  It currently affects
+// only the shadow database, as the others were always strict.
+func Strict() ParseOption {
+	return func(o *parseOptions) { o.strict = true }
+}
+
+// plainText is used by the Parse*Map functions for databases without
+// a password field.
+func plainText() ParseOption {
+	return func(o *parseOptions) { o.plain = true }
+}
+
+// ParseErrors is returned by lenient parsing and lists every record
+// that could not be parsed, in the order they appear.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.Error()
+	}
+	return strconv.Itoa(len(e)) + " records could not be parsed:\n" + strings.Join(msgs, "\n")
+}
+
+// Is reports if any of the errors is target, so that errors.Is can
+// be used on the list as a whole.
+func (e ParseErrors) Is(target error) bool {
+	for _, pe := range e {
+		if errors.Is(pe, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// preserved holds the lines of a database that are not entries, such
+// as comments, blank lines and records that failed to parse, so that
+// they can be written back unchanged.  Each run of lines is attached
+// to the entry that follows it, and lines after the last entry are
+// kept in tail.  The original text of entries that would not be
+// written back the same way, for example because of trailing
+// whitespace, is kept in orig and used for as long as the entry is
+// not modified.
+type preserved struct {
+	before  map[interface{}][]string
+	orig    map[interface{}]original
+	tail    []string
+	pending []string
+
+	// noEOL is set if the last line, last, had no newline.
+	noEOL bool
+	last  string
+}
+
+// original is the text an entry was parsed from, and the text the
+// entry would have been written as at the time.
+type original struct {
+	text  string
+	canon string
+}
+
+// add queues a line to be attached to the next entry kept.
+func (p *preserved) add(line string) {
+	p.pending = append(p.pending, line)
+}
+
+// keep attaches any queued lines to e.
+func (p *preserved) keep(e interface{}) {
+	if len(p.pending) == 0 {
+		return
+	}
+	if p.before == nil {
+		p.before = make(map[interface{}][]string)
+	}
+	p.before[e] = append(p.pending, p.before[e]...)
+	p.pending = nil
+}
+
+// parsed records that e was parsed from text.
+func (p *preserved) parsed(e fmt.Stringer, text string) {
+	canon := e.String()
+	if canon == text {
+		return
+	}
+	if p.orig == nil {
+		p.orig = make(map[interface{}]original)
+	}
+	p.orig[e] = original{text, canon}
+}
+
+// drop detaches the lines before e, which is being removed, and
+// queues them for the next entry kept.
+func (p *preserved) drop(e interface{}) {
+	p.pending = append(p.pending, p.before[e]...)
+	delete(p.before, e)
+	delete(p.orig, e)
+}
+
+// flush moves any queued lines to the end of the database.
+func (p *preserved) flush() {
+	p.tail = append(p.pending, p.tail...)
+	p.pending = nil
+}
+
+// copyFrom attaches the lines and original text that o has for old
+// to e.
+func (p *preserved) copyFrom(o *preserved, old, e interface{}) {
+	if lines := o.before[old]; len(lines) > 0 {
+		if p.before == nil {
+			p.before = make(map[interface{}][]string)
+		}
+		p.before[e] = append([]string(nil), lines...)
+	}
+	if orig, ok := o.orig[old]; ok {
+		if p.orig == nil {
+			p.orig = make(map[interface{}]original)
+		}
+		p.orig[e] = orig
+	}
+}
+
+// copyTail copies the lines that o has after the last entry.
+func (p *preserved) copyTail(o *preserved) {
+	p.tail = append([]string(nil), o.tail...)
+	p.noEOL = o.noEOL
+	p.last = o.last
+}
+
+// line advances *n past the lines written for e and returns the line
+// that e itself is written on.
+func (p *preserved) line(n *int, e interface{}) int {
+	*n += len(p.before[e]) + 1
+	return *n
+}
+
+// write writes the lines that come before e, followed by e itself,
+// which is s when formatted.  An entry that is unchanged since it was
+// parsed is written as its original text.
+func (p *preserved) write(out *strings.Builder, e interface{}, s string) {
+	for _, l := range p.before[e] {
+		out.WriteString(l)
+		out.WriteRune('\n')
+	}
+	if orig, ok := p.orig[e]; ok && orig.canon == s {
+		s = orig.text
+	}
+	out.WriteString(s)
+	out.WriteRune('\n')
+}
+
+// end writes the lines that come after the last entry and returns the
+// complete database.  A missing newline at the end is reproduced for
+// as long as the last line is unchanged.
+func (p *preserved) end(out *strings.Builder) string {
+	for _, l := range p.tail {
+		out.WriteString(l)
+		out.WriteRune('\n')
+	}
+	s := out.String()
+	if p.noEOL && (s == p.last+"\n" || strings.HasSuffix(s, "\n"+p.last+"\n")) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// ignored reports if a line is a comment or blank, neither of which
+// is an entry.
+func ignored(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// scanLines is bufio.ScanLines, except that carriage returns are left
+// in place so that they can be written back.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// lastByteReader remembers the last byte read from r.
+type lastByteReader struct {
+	r    io.Reader
+	last byte
+}
+
+func (l *lastByteReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n > 0 {
+		l.last = p[n-1]
+	}
+	return n, err
+}
+
+// parseLines calls parse on every line of r that is not a comment or
+// blank, with trailing whitespace removed.  Parse returns the entry it
+// produced, which lines kept in raw are attached to.  Unless parsing
+// is lenient the first error is returned.
+func parseLines(r io.Reader, opts []ParseOption, raw *preserved, parse func(string) (fmt.Stringer, error)) error {
+	o := newParseOptions(opts)
+
+	src := sourceName(r)
+	errs := ParseErrors{}
+	n := 0
+	text := ""
+	lr := &lastByteReader{r: r}
+	scanner := bufio.NewScanner(lr)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		n++
+		text = scanner.Text()
+		if ignored(text) {
+			raw.add(text)
+			continue
+		}
+		e, err := parse(strings.TrimRight(text, " \t\r"))
+		if err != nil {
+			pe := lineError(err, src, n, text, !o.plain)
+			if !o.lenient {
+				return pe
+			}
+			errs = append(errs, pe)
+			raw.add(text)
+			continue
+		}
+		raw.parsed(e, text)
+		raw.keep(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	raw.flush()
+	if n > 0 && lr.last != '\n' {
+		raw.noEOL = true
+		raw.last = text
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// keepMap reports if a Parse*Map function should return its map
+// along with err from parseLines, which is only the case for errors
+// from lenient parsing.
+func keepMap(err error) bool {
+	_, lenient := err.(ParseErrors)
+	return err == nil || lenient
+}
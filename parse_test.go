@@ -0,0 +1,109 @@
+package shadow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const brokenPasswd = `root:x:0:0:root:/root:/bin/sh
+broken:x:potato:100::/:/bin/sh
+maldridge:x:1000:1000:maldridge:/home/maldridge:/bin/sh
+short:x:1001
+`
+
+func TestParseLenient(t *testing.T) {
+	if pm, err := ParsePasswdMap(strings.NewReader(brokenPasswd)); pm != nil || !errors.Is(err, ErrNotANumber) {
+		t.Errorf("Strict: Got %v, %v", pm, err)
+	}
+
+	pm, err := ParsePasswdMap(strings.NewReader(brokenPasswd), Lenient())
+	if pm == nil {
+		t.Fatalf("Got no map: %v", err)
+	}
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Got %v; Want 2 ParseErrors", err)
+	}
+	if errs[0].Line != 2 || !errors.Is(errs[0], ErrNotANumber) {
+		t.Errorf("Got %v", errs[0])
+	}
+	if errs[1].Line != 4 || !errors.Is(errs[1], ErrWrongNumFields) {
+		t.Errorf("Got %v", errs[1])
+	}
+	if !errors.Is(err, ErrWrongNumFields) {
+		t.Error("errors.Is did not find ErrWrongNumFields in the list")
+	}
+
+	if len(pm.lines) != 2 {
+		t.Errorf("Got %d entries; Want 2", len(pm.lines))
+	}
+	if pm.String() != brokenPasswd {
+		t.Errorf("Got:\n%s\nWant:\n%s", pm, brokenPasswd)
+	}
+
+	// Removing the entry after a preserved line keeps the line.
+	pm.Del([]*PasswdEntry{pm.lines[1]})
+	want := "root:x:0:0:root:/root:/bin/sh\nbroken:x:potato:100::/:/bin/sh\nshort:x:1001\n"
+	if pm.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", pm, want)
+	}
+}
+
+func TestParseLenientClean(t *testing.T) {
+	gm, err := ParseGroupMap(strings.NewReader("wheel:x:10:maldridge\n"), Lenient())
+	if err != nil || gm == nil {
+		t.Errorf("Got %v, %v", gm, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cases := []string{
+		"# Managed by hand\n\nroot:x:0:0:root:/root:/bin/sh\n  \nmaldridge:x:1000:1000::/home/maldridge:/bin/sh\n# end\n",
+		"root:x:0:0:root:/root:/bin/sh   \nmaldridge:x:1000:1000::/home/maldridge:/bin/sh\t\n",
+		"root:x:0:0:root:/root:/bin/sh\r\nmaldridge:x:1000:1000::/home/maldridge:/bin/sh\r\n",
+		"root:x:0:0:root:/root:/bin/sh\nmaldridge:x:1000:1000::/home/maldridge:/bin/sh",
+		"root:x:0:0:root:/root:/bin/sh\n# no newline",
+		"",
+	}
+
+	for i, c := range cases {
+		pm, err := ParsePasswdMap(strings.NewReader(c))
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if pm.String() != c {
+			t.Errorf("%d: Got %q; Want %q", i, pm.String(), c)
+		}
+	}
+}
+
+func TestRoundTripEdit(t *testing.T) {
+	in := "# users\nroot:x:0:0:root:/root:/bin/sh  \n\nmaldridge:x:1000:1000::/home/maldridge:/bin/sh  "
+	pm, err := ParsePasswdMap(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pm.lines) != 2 || pm.lines[0].Shell != "/bin/sh" {
+		t.Fatalf("Got %v", pm.lines)
+	}
+
+	// Only the modified entry is rewritten, and as the last line
+	// has changed it gains a newline.
+	pm.lines[1].Shell = "/bin/bash"
+	want := "# users\nroot:x:0:0:root:/root:/bin/sh  \n\nmaldridge:x:1000:1000::/home/maldridge:/bin/bash\n"
+	if pm.String() != want {
+		t.Errorf("Got %q; Want %q", pm.String(), want)
+	}
+
+	sm, err := ParseShadowMap(strings.NewReader("root:*:017518:0:99999:7:::\nmaldridge:!:17518::::::\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.lines[1].Password = "*"
+	want = "root:*:017518:0:99999:7:::\nmaldridge:*:17518::::::\n"
+	if sm.String() != want {
+		t.Errorf("Got %q; Want %q", sm.String(), want)
+	}
+}
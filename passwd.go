@@ -1,7 +1,7 @@
 package shadow
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -17,9 +17,31 @@ type PasswdEntry struct {
 	Comment  string
 	Home     string
 	Shell    string
+
+	// HasUID and HasGID report if a compat entry overrides the
+	// numeric fields.  They are not used by other entries, which
+	// always have both.
+	HasUID bool
+	HasGID bool
 }
 
+// passwdFields names the fields of a PasswdEntry for errors.
+var passwdFields = []string{"login", "password", "uid", "gid", "comment", "home", "shell"}
+
 func (pe PasswdEntry) String() string {
+	if pe.Compat() != CompatNone {
+		if pe.Password == "" && !pe.HasUID && !pe.HasGID &&
+			pe.Comment == "" && pe.Home == "" && pe.Shell == "" {
+			return pe.Login
+		}
+		return pe.Login + ":" +
+			pe.Password + ":" +
+			optItoa(pe.UID, pe.HasUID) + ":" +
+			optItoa(pe.GID, pe.HasGID) + ":" +
+			pe.Comment + ":" +
+			pe.Home + ":" +
+			pe.Shell
+	}
 	return pe.Login + ":" +
 		pe.Password + ":" +
 		strconv.Itoa(pe.UID) + ":" +
@@ -32,11 +54,16 @@ func (pe PasswdEntry) String() string {
 // Parse parses a single line into a PasswdEntry struct.  Errors
 // are returned if the wrong number of fields are present in the input
 // string, or if the string contains illegal characters such as
-// newlines.
+// newlines.  NIS compat entries, which start with "+" or "-", may
+// leave out trailing fields and leave the numeric fields empty.
 func (pe *PasswdEntry) Parse(s string) error {
+	if compatKind(s) != CompatNone {
+		return pe.parseCompat(s)
+	}
+
 	fields := strings.Split(s, ":")
 	if len(fields) != 7 {
-		return ErrWrongNumFields
+		return recordError(ErrWrongNumFields)
 	}
 
 	pe.Login = fields[0]
@@ -48,58 +75,104 @@ func (pe *PasswdEntry) Parse(s string) error {
 	uid, err := strconv.Atoi(fields[2])
 	if err != nil {
 		*pe = PasswdEntry{}
-		return ErrNotANumber
+		return fieldError(passwdFields, 2, ErrNotANumber)
 	}
 	pe.UID = uid
 
 	gid, err := strconv.Atoi(fields[3])
 	if err != nil {
 		*pe = PasswdEntry{}
-		return ErrNotANumber
+		return fieldError(passwdFields, 3, ErrNotANumber)
 	}
 	pe.GID = gid
 
 	return nil
 }
 
+func (pe *PasswdEntry) parseCompat(s string) error {
+	fields, err := compatFields(s, 7)
+	if err != nil {
+		return err
+	}
+
+	*pe = PasswdEntry{
+		Login:    fields[0],
+		Password: fields[1],
+		Comment:  fields[4],
+		Home:     fields[5],
+		Shell:    fields[6],
+	}
+	if pe.UID, pe.HasUID, err = optInt(fields[2]); err != nil {
+		*pe = PasswdEntry{}
+		return fieldError(passwdFields, 2, ErrNotANumber)
+	}
+	if pe.GID, pe.HasGID, err = optInt(fields[3]); err != nil {
+		*pe = PasswdEntry{}
+		return fieldError(passwdFields, 3, ErrNotANumber)
+	}
+	return nil
+}
+
 // A PasswdMap is a complete set of passwd entries that can be written
 // and used as a list of entities on a system.
 type PasswdMap struct {
 	lines []*PasswdEntry
+	raw   preserved
+
+	// byLogin and byUID index the entries for lookups.  They are
+	// built on the first lookup and discarded by Del.
+	byLogin map[string]*PasswdEntry
+	byUID   map[int]*PasswdEntry
 }
 
 func (pm PasswdMap) String() string {
 	b := new(strings.Builder)
 	for _, l := range pm.lines {
-		b.WriteString(l.String())
-		b.WriteRune('\n')
+		pm.raw.write(b, l, l.String())
 	}
-	return b.String()
+	return pm.raw.end(b)
+}
+
+// WriteFile atomically replaces the passwd database at path with the
+// contents of the map.  The global and per-file locks are held for
+// the duration of the write.
+func (pm *PasswdMap) WriteFile(path string) error {
+	return writeLocked(path, []byte(pm.String()), 0644)
 }
 
 // ParsePasswdMap loads a specified reader into a password map for
 // manipulation.
-func ParsePasswdMap(r io.Reader) (*PasswdMap, error) {
-	lines := []*PasswdEntry{}
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
+func ParsePasswdMap(r io.Reader, opts ...ParseOption) (*PasswdMap, error) {
+	pm := &PasswdMap{lines: []*PasswdEntry{}}
+	err := parseLines(r, opts, &pm.raw, func(s string) (fmt.Stringer, error) {
 		t := new(PasswdEntry)
-		if err := t.Parse(scanner.Text()); err != nil {
+		if err := t.Parse(s); err != nil {
 			return nil, err
 		}
-		lines = append(lines, t)
+		pm.lines = append(pm.lines, t)
+		return t, nil
+	})
+	if !keepMap(err) {
+		return nil, err
 	}
-	pm := new(PasswdMap)
-	pm.lines = lines
-	return pm, nil
+	return pm, err
 }
 
 // FilterUID applies a NumericFilter to the UID field of all loaded
 // PasswdEntry's and returns a list of all entries that matched.
-func (pm *PasswdMap) FilterUID(f NumericFilter) []*PasswdEntry {
+// Compat entries are skipped unless IncludeCompat is given.
+func (pm *PasswdMap) FilterUID(f NumericFilter, opts ...FilterOption) []*PasswdEntry {
+	return pm.Filter(PasswdUID(f), opts...)
+}
+
+// Filter applies a PasswdFilter to all loaded PasswdEntry's and
+// returns a list of all entries that matched.  Compat entries are
+// skipped unless IncludeCompat is given.
+func (pm *PasswdMap) Filter(f PasswdFilter, opts ...FilterOption) []*PasswdEntry {
+	o := newFilterOptions(opts)
 	nl := []*PasswdEntry{}
 	for _, l := range pm.lines {
-		if !f(l.UID) {
+		if o.skip(l.Compat()) || !f(l) {
 			// Filter did not match.
 			continue
 		}
@@ -112,6 +185,9 @@ func (pm *PasswdMap) FilterUID(f NumericFilter) []*PasswdEntry {
 // enforced.
 func (pm *PasswdMap) Add(a []*PasswdEntry) {
 	pm.lines = append(pm.lines, a...)
+	if pm.byLogin != nil {
+		pm.indexEntries(a)
+	}
 }
 
 // Del iterates through the provided list and removes entities that
@@ -131,11 +207,72 @@ func (pm *PasswdMap) Del(d []*PasswdEntry) {
 		if doTest && *l == *e {
 			// The entity is an exact match and should be
 			// removed.
+			pm.raw.drop(l)
 			continue
 		}
 		// The entity is not an exact match, and should be
 		// retained.
+		pm.raw.keep(l)
 		out = append(out, l)
 	}
+	pm.raw.flush()
 	pm.lines = out
+	pm.Reindex()
+}
+
+// LookupLogin returns the entry for login, or nil if there isn't
+// one.  Compat entries are never returned.  Reindex must be called
+// after changing the login or UID of an entry in place, or lookups
+// of the new value will not find it.
+func (pm *PasswdMap) LookupLogin(login string) *PasswdEntry {
+	if pe := pm.index().byLogin[login]; pe == nil || pe.Login == login {
+		return pe
+	}
+	// The entry was renamed since the index was built.
+	pm.Reindex()
+	return pm.index().byLogin[login]
+}
+
+// LookupUID returns the first entry with the given UID, or nil if
+// there isn't one.  Compat entries are never returned.
+func (pm *PasswdMap) LookupUID(uid int) *PasswdEntry {
+	if pe := pm.index().byUID[uid]; pe == nil || pe.UID == uid {
+		return pe
+	}
+	pm.Reindex()
+	return pm.index().byUID[uid]
+}
+
+// index builds the indexes if they are not already built.
+func (pm *PasswdMap) index() *PasswdMap {
+	if pm.byLogin == nil {
+		pm.byLogin = make(map[string]*PasswdEntry, len(pm.lines))
+		pm.byUID = make(map[int]*PasswdEntry, len(pm.lines))
+		pm.indexEntries(pm.lines)
+	}
+	return pm
+}
+
+// indexEntries adds entries to the indexes, keeping any existing
+// entry with the same key as it comes first.
+func (pm *PasswdMap) indexEntries(entries []*PasswdEntry) {
+	for _, l := range entries {
+		if l.Compat() != CompatNone {
+			continue
+		}
+		if _, ok := pm.byLogin[l.Login]; !ok {
+			pm.byLogin[l.Login] = l
+		}
+		if _, ok := pm.byUID[l.UID]; !ok {
+			pm.byUID[l.UID] = l
+		}
+	}
+}
+
+// Reindex discards the lookup indexes, which are rebuilt by the next
+// lookup.  It must be called after the login or UID of an entry is
+// changed in place.
+func (pm *PasswdMap) Reindex() {
+	pm.byLogin = nil
+	pm.byUID = nil
 }
@@ -1,6 +1,7 @@
 package shadow
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -61,7 +62,7 @@ func TestPasswdEntryParse(t *testing.T) {
 
 	for i, c := range cases {
 		p := new(PasswdEntry)
-		if err := p.Parse(c.line); err != c.wantErr {
+		if err := p.Parse(c.line); !errors.Is(err, c.wantErr) {
 			t.Errorf("%d: Got %v Want %v", i, err, c.wantErr)
 		}
 		if *p != c.entry {
@@ -115,7 +116,7 @@ func TestParsePasswdMap(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		if _, err := ParsePasswdMap(c.r); err != c.wantErr {
+		if _, err := ParsePasswdMap(c.r); !errors.Is(err, c.wantErr) {
 			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
 		}
 	}
@@ -177,3 +178,61 @@ func TestPasswdDel(t *testing.T) {
 		t.Error("Incorrect delete")
 	}
 }
+
+func TestPasswdLookup(t *testing.T) {
+	pm, err := ParsePasswdMap(strings.NewReader("root:x:0:0:root:/root:/bin/sh\nmaldridge:x:1000:1000::/home/maldridge:/bin/sh\ntoor:x:0:0::/root:/bin/sh\n+::::::\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pe := pm.LookupLogin("maldridge"); pe == nil || pe.UID != 1000 {
+		t.Errorf("Got %v", pe)
+	}
+	if pe := pm.LookupUID(0); pe == nil || pe.Login != "root" {
+		t.Errorf("Got %v; Want the first entry with UID 0", pe)
+	}
+	if pe := pm.LookupLogin("+"); pe != nil {
+		t.Errorf("Got compat entry %v", pe)
+	}
+
+	pm.Add([]*PasswdEntry{{Login: "new", UID: 1001}, {Login: "root", UID: 1002}})
+	if pe := pm.LookupUID(1001); pe == nil || pe.Login != "new" {
+		t.Errorf("Got %v after Add", pe)
+	}
+	if pe := pm.LookupLogin("root"); pe == nil || pe.UID != 0 {
+		t.Errorf("Got %v; Want the first root", pe)
+	}
+
+	pm.Del([]*PasswdEntry{pm.LookupLogin("root")})
+	if pe := pm.LookupLogin("root"); pe == nil || pe.UID != 1002 {
+		t.Errorf("Got %v after Del", pe)
+	}
+	if pe := pm.LookupUID(0); pe == nil || pe.Login != "toor" {
+		t.Errorf("Got %v after Del", pe)
+	}
+
+	// An entry whose key changed in place is not found by its old
+	// key.
+	pm.LookupLogin("maldridge").Login = "mal"
+	if pe := pm.LookupLogin("maldridge"); pe != nil {
+		t.Errorf("Got %v after rename", pe)
+	}
+	if pe := pm.LookupLogin("mal"); pe == nil {
+		t.Error("Renamed entry not found")
+	}
+
+	// Lookups of a new key need the indexes to be rebuilt.
+	pm.LookupLogin("mal").Login = "maldridge"
+	pm.Reindex()
+	if pe := pm.LookupLogin("maldridge"); pe == nil {
+		t.Error("Renamed entry not found")
+	}
+	pm.LookupUID(1000).UID = 2000
+	pm.Reindex()
+	if pe := pm.LookupUID(2000); pe == nil || pe.Login != "maldridge" {
+		t.Errorf("Got %v after changing the UID", pe)
+	}
+	if pe := pm.LookupUID(1000); pe != nil {
+		t.Errorf("Got %v by the old UID", pe)
+	}
+}
@@ -0,0 +1,154 @@
+package shadow
+
+import (
+	"strconv"
+	"strings"
+)
+
+// These hashing methods are recognized by HashMethod but cannot be
+// used to set a password.
+const (
+	MethodDES = "DES"
+	MethodMD5 = "MD5"
+)
+
+// PasswordState is the state of a password as reported by the second
+// field of `passwd -S`.
+type PasswordState int
+
+// The states correspond to the "P", "L" and "NP" codes printed by
+// passwd(1).  Disabled passwords such as "*" are reported as locked,
+// just as passwd does.
+const (
+	PasswordUsable PasswordState = iota
+	PasswordLocked
+	PasswordEmpty
+)
+
+func (s PasswordState) String() string {
+	switch s {
+	case PasswordUsable:
+		return "P"
+	case PasswordLocked:
+		return "L"
+	case PasswordEmpty:
+		return "NP"
+	default:
+		return "?"
+	}
+}
+
+// PasswordStatus is the information printed by `passwd -S`.  Aging
+// fields that are not set are reported as -1, which is how
+// shadow-utils stores them internally.
+type PasswordStatus struct {
+	Login          string
+	State          PasswordState
+	LastChanged    string
+	MinimumAge     int
+	MaximumAge     int
+	WarningDays    int
+	InactivityDays int
+}
+
+// String formats the status in the same way as `passwd -S`.
+func (ps PasswordStatus) String() string {
+	return ps.Login + " " +
+		ps.State.String() + " " +
+		ps.LastChanged + " " +
+		strconv.Itoa(ps.MinimumAge) + " " +
+		strconv.Itoa(ps.MaximumAge) + " " +
+		strconv.Itoa(ps.WarningDays) + " " +
+		strconv.Itoa(ps.InactivityDays)
+}
+
+// Status returns the state of the password and its aging values.
+func (se *ShadowEntry) Status() PasswordStatus {
+	ps := PasswordStatus{
+		Login:          se.Login,
+		State:          PasswordUsable,
+		LastChanged:    "never",
+		MinimumAge:     intField(se.MinimumPasswordAge, se.HasMinimumPasswordAge),
+		MaximumAge:     intField(se.MaximumPasswordAge, se.HasMaximumPasswordAge),
+		WarningDays:    intField(se.WarningDays, se.HasWarningDays),
+		InactivityDays: intField(se.InactivityDays, se.HasInactivityDays),
+	}
+	switch {
+	case se.Password == "":
+		ps.State = PasswordEmpty
+	case se.IsLocked(), se.IsDisabled():
+		ps.State = PasswordLocked
+	}
+	if dayField(se.LastChanged, se.HasLastChanged) >= 0 {
+		ps.LastChanged = se.LastChanged.Format("2006-01-02")
+	}
+	return ps
+}
+
+// Lock locks the password by prefixing it with "!", in the same way
+// as `passwd -l`.  The password hash is retained so that it can be
+// restored by Unlock.  Locking an already locked entry does nothing.
+func (se *ShadowEntry) Lock() {
+	if !se.IsLocked() {
+		se.Password = "!" + se.Password
+	}
+}
+
+// Unlock removes a single "!" added by Lock.  ErrEmptyPassword is
+// returned, and the entry left locked, if unlocking would leave the
+// account without a password.  Unlocking an entry that is not locked
+// does nothing.
+func (se *ShadowEntry) Unlock() error {
+	if !se.IsLocked() {
+		return nil
+	}
+	if se.Password == "!" {
+		return ErrEmptyPassword
+	}
+	se.Password = se.Password[1:]
+	return nil
+}
+
+// IsLocked reports if the password has been locked with Lock or an
+// equivalent tool.
+func (se *ShadowEntry) IsLocked() bool {
+	return strings.HasPrefix(se.Password, "!")
+}
+
+// IsDisabled reports if the password is one such as "*" that can
+// never match, as is used for system accounts.  Locked passwords are
+// not considered disabled.
+func (se *ShadowEntry) IsDisabled() bool {
+	return strings.HasPrefix(se.Password, "*")
+}
+
+// HasNoPassword reports if the password field is empty, which allows
+// logging in without a password.
+func (se *ShadowEntry) HasNoPassword() bool {
+	return se.Password == ""
+}
+
+// HashMethod returns the method used to hash the password, using the
+// names from ENCRYPT_METHOD in login.defs, or the empty string if the
+// password is not a recognized hash.  A lock prefix is ignored.
+func (se *ShadowEntry) HashMethod() string {
+	p := strings.TrimLeft(se.Password, "!")
+	switch {
+	case strings.HasPrefix(p, "$1$"):
+		return MethodMD5
+	case strings.HasPrefix(p, "$5$"):
+		return MethodSHA256
+	case strings.HasPrefix(p, "$6$"):
+		return MethodSHA512
+	case strings.HasPrefix(p, "$2a$"),
+		strings.HasPrefix(p, "$2b$"),
+		strings.HasPrefix(p, "$2y$"):
+		return MethodBcrypt
+	case strings.HasPrefix(p, "$y$"):
+		return MethodYescrypt
+	case len(p) == 13 && strings.Trim(p, cryptAlphabet) == "":
+		return MethodDES
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,92 @@
+package shadow
+
+import (
+	"testing"
+)
+
+func TestLockUnlock(t *testing.T) {
+	se := &ShadowEntry{Login: "maldridge", Password: "$6$saltstring$hash"}
+
+	se.Lock()
+	if se.Password != "!$6$saltstring$hash" || !se.IsLocked() {
+		t.Errorf("Lock: Got %s", se.Password)
+	}
+	se.Lock()
+	if se.Password != "!$6$saltstring$hash" {
+		t.Errorf("Lock twice: Got %s", se.Password)
+	}
+	if se.HashMethod() != MethodSHA512 {
+		t.Errorf("HashMethod: Got %s; Want %s", se.HashMethod(), MethodSHA512)
+	}
+
+	if err := se.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if se.Password != "$6$saltstring$hash" || se.IsLocked() {
+		t.Errorf("Unlock: Got %s", se.Password)
+	}
+	if err := se.Unlock(); err != nil || se.Password != "$6$saltstring$hash" {
+		t.Errorf("Unlock twice: Got %s, %v", se.Password, err)
+	}
+
+	se = &ShadowEntry{Login: "maldridge"}
+	se.Lock()
+	if err := se.Unlock(); err != ErrEmptyPassword {
+		t.Errorf("Unlock empty: Got %v; Want %v", err, ErrEmptyPassword)
+	}
+	if se.Password != "!" {
+		t.Errorf("Unlock empty: Got %s; Want !", se.Password)
+	}
+}
+
+func TestHashMethod(t *testing.T) {
+	cases := []struct {
+		password string
+		want     string
+	}{
+		{"", ""},
+		{"*", ""},
+		{"!!", ""},
+		{"$1$salt$hash", MethodMD5},
+		{"$5$salt$hash", MethodSHA256},
+		{"!$6$salt$hash", MethodSHA512},
+		{"$2y$10$hash", MethodBcrypt},
+		{"$y$j9T$salt$hash", MethodYescrypt},
+		{"abJnggxhB/yWI", MethodDES},
+		{"abJnggxhB/yW*", ""},
+	}
+
+	for _, c := range cases {
+		se := &ShadowEntry{Password: c.password}
+		if got := se.HashMethod(); got != c.want {
+			t.Errorf("%q: Got %q; Want %q", c.password, got, c.want)
+		}
+	}
+}
+
+func TestPasswordStatus(t *testing.T) {
+	cases := []struct {
+		line string
+		want string
+	}{
+		{"root:*:18000:0:99999:7:::", "root L 2019-04-14 0 99999 7 -1"},
+		{"maldridge:$6$salt$hash:0::::::", "maldridge P 1970-01-01 -1 -1 -1 -1"},
+		{"guest::::::::", "guest NP never -1 -1 -1 -1"},
+		{"locked:!$6$salt$hash:18000:1:90:14:30::", "locked L 2019-04-14 1 90 14 30"},
+	}
+
+	for _, c := range cases {
+		se := new(ShadowEntry)
+		if err := se.Parse(c.line); err != nil {
+			t.Fatal(err)
+		}
+		if got := se.Status().String(); got != c.want {
+			t.Errorf("Got %q; Want %q", got, c.want)
+		}
+	}
+
+	se := &ShadowEntry{Password: "*"}
+	if !se.IsDisabled() || se.IsLocked() || se.HasNoPassword() {
+		t.Error("* should only be disabled")
+	}
+}
@@ -0,0 +1,528 @@
+package shadow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A DesiredUser is a user as it should exist after reconciling.  When
+// the user is created, fields that are left empty get the same
+// defaults as with AddUser.  When the user already exists, fields
+// that are left empty are not changed.
+type DesiredUser struct {
+	Login string
+
+	// Password is the already hashed password.  New users without
+	// one are locked.
+	Password string
+
+	UID    int
+	HasUID bool
+	System bool
+
+	Comment string
+	Home    string
+	Shell   string
+
+	// PrimaryGroup names the primary group.  If it is empty, new
+	// users get a user private group unless a group with their
+	// name is desired, and existing users keep theirs.
+	PrimaryGroup string
+
+	// Groups is the complete list of supplementary groups.  If it
+	// is nil the memberships of existing users are not changed.
+	Groups []string
+}
+
+// A DesiredGroup is a group as it should exist after reconciling.
+type DesiredGroup struct {
+	Name string
+
+	// GID is only used if HasGID is set, otherwise a free GID is
+	// allocated for new groups and existing groups keep theirs.
+	GID    int
+	HasGID bool
+	System bool
+}
+
+// A DesiredState is the complete set of users and groups that an
+// inventory manages.
+type DesiredState struct {
+	Users  []DesiredUser
+	Groups []DesiredGroup
+
+	// ManagedUsers and ManagedGroups mark the existing accounts
+	// that the inventory owns, for example with a UID range or a
+	// marker in the comment.  Owned accounts that are not desired
+	// are removed.  Accounts that are not owned are never changed
+	// or removed, even if they are desired.  If a filter is nil
+	// every desired account is owned, and nothing is removed.
+	// The user private groups of removed users are only removed
+	// if ManagedGroups owns them.
+	ManagedUsers  PasswdFilter
+	ManagedGroups GroupFilter
+
+	// ValidateOptions are used to validate the desired users and
+	// groups, for example to allow the upper case names of
+	// existing accounts.
+	ValidateOptions []ValidateOption
+}
+
+// ActionKind is the kind of step in a Plan.
+type ActionKind int
+
+// Actions are planned in the order they are listed here, so that
+// groups exist before the users that need them, and users are gone
+// before their groups are removed.  The skip actions record desired
+// accounts that are left alone because they are not owned.
+const (
+	ActionCreateGroup ActionKind = iota
+	ActionModifyGroup
+	ActionCreateUser
+	ActionModifyUser
+	ActionDeleteUser
+	ActionDeleteGroup
+	ActionSkipUser
+	ActionSkipGroup
+)
+
+func (k ActionKind) String() string {
+	switch k {
+	case ActionCreateGroup:
+		return "create-group"
+	case ActionModifyGroup:
+		return "modify-group"
+	case ActionCreateUser:
+		return "create-user"
+	case ActionModifyUser:
+		return "modify-user"
+	case ActionDeleteUser:
+		return "delete-user"
+	case ActionDeleteGroup:
+		return "delete-group"
+	case ActionSkipUser:
+		return "skip-user"
+	case ActionSkipGroup:
+		return "skip-group"
+	default:
+		return "unknown"
+	}
+}
+
+// An Action is a single step of a Plan.  Changes lists the fields
+// that a modify action changes, with password hashes redacted, and
+// Reason explains why an account is skipped.
+type Action struct {
+	Kind    ActionKind
+	Name    string
+	Changes []FieldChange
+	Reason  string
+
+	user  *DesiredUser
+	group *DesiredGroup
+}
+
+func (a Action) String() string {
+	s := a.Kind.String() + " " + a.Name
+	if len(a.Changes) > 0 {
+		parts := make([]string, len(a.Changes))
+		for i, c := range a.Changes {
+			parts[i] = fmt.Sprintf("%s %q -> %q", c.Field, c.Old, c.New)
+		}
+		s += ": " + strings.Join(parts, ", ")
+	}
+	if a.Reason != "" {
+		s += ": " + a.Reason
+	}
+	return s
+}
+
+// A Plan is the list of actions that bring the databases to a
+// desired state.
+type Plan struct {
+	Actions []Action
+}
+
+// Empty reports if the plan changes nothing.
+func (p *Plan) Empty() bool {
+	for _, a := range p.Actions {
+		if a.Kind != ActionSkipUser && a.Kind != ActionSkipGroup {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the actions one per line.
+func (p *Plan) String() string {
+	b := new(strings.Builder)
+	for _, a := range p.Actions {
+		b.WriteString(a.String() + "\n")
+	}
+	return b.String()
+}
+
+type jsonAction struct {
+	Action  string       `json:"action"`
+	Name    string       `json:"name"`
+	Changes []jsonChange `json:"changes,omitempty"`
+	Reason  string       `json:"reason,omitempty"`
+}
+
+type jsonChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// WriteJSON writes the plan as a JSON object with a list of actions,
+// for other tools to consume.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	out := struct {
+		Actions []jsonAction `json:"actions"`
+	}{
+		Actions: []jsonAction{},
+	}
+	for _, a := range p.Actions {
+		ja := jsonAction{Action: a.Kind.String(), Name: a.Name, Reason: a.Reason}
+		for _, c := range a.Changes {
+			ja.Changes = append(ja.Changes, jsonChange{c.Field, c.Old, c.New})
+		}
+		out.Actions = append(out.Actions, ja)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// Reconcile brings the databases to the desired state and returns
+// the plan it followed.  If dryRun is set the plan is only computed.
+// As with the other changes to a DB, nothing is written until the
+// transaction holding it is committed.
+func (db *DB) Reconcile(ds DesiredState, dryRun bool) (*Plan, error) {
+	p, err := db.Plan(ds)
+	if err != nil || dryRun {
+		return p, err
+	}
+	return p, p.Apply(db)
+}
+
+// Plan computes the actions that bring the databases to the desired
+// state without changing anything.  An error is returned if the
+// desired state is invalid, for example because it lists a user
+// twice, names a group that will not exist, or contains a field that
+// Validate rejects.
+func (db *DB) Plan(ds DesiredState) (*Plan, error) {
+	if err := db.checkDesired(ds); err != nil {
+		return nil, err
+	}
+
+	ownsUser := func(pe *PasswdEntry) bool {
+		return ds.ManagedUsers == nil || ds.ManagedUsers(pe)
+	}
+	ownsGroup := func(ge *GroupEntry) bool {
+		return ds.ManagedGroups == nil || ds.ManagedGroups(ge)
+	}
+
+	var create, modify, remove, skip []Action
+
+	desiredGroups := make(map[string]bool)
+	for i := range ds.Groups {
+		g := &ds.Groups[i]
+		desiredGroups[g.Name] = true
+		ge := db.Group.LookupName(g.Name)
+		switch {
+		case ge == nil:
+			create = append(create, Action{Kind: ActionCreateGroup, Name: g.Name, group: g})
+		case !ownsGroup(ge):
+			skip = append(skip, Action{Kind: ActionSkipGroup, Name: g.Name, Reason: "not managed"})
+		case g.HasGID && g.GID != ge.GID:
+			modify = append(modify, Action{
+				Kind:    ActionModifyGroup,
+				Name:    g.Name,
+				Changes: []FieldChange{{"gid", strconv.Itoa(ge.GID), strconv.Itoa(g.GID)}},
+				group:   g,
+			})
+		}
+	}
+
+	desiredUsers := make(map[string]bool)
+	var createUsers, modifyUsers []Action
+	for i := range ds.Users {
+		u := &ds.Users[i]
+		desiredUsers[u.Login] = true
+		pe := db.Passwd.LookupLogin(u.Login)
+		switch {
+		case pe == nil:
+			createUsers = append(createUsers, Action{Kind: ActionCreateUser, Name: u.Login, user: u})
+		case !ownsUser(pe):
+			skip = append(skip, Action{Kind: ActionSkipUser, Name: u.Login, Reason: "not managed"})
+		default:
+			if changes := db.userChanges(pe, u); len(changes) > 0 {
+				modifyUsers = append(modifyUsers, Action{Kind: ActionModifyUser, Name: u.Login, Changes: changes, user: u})
+			}
+		}
+	}
+
+	// The groups desired users are given are desired with them,
+	// including the group a new user adopts as their primary group
+	// because it has their name.
+	for _, u := range ds.Users {
+		for _, g := range u.Groups {
+			desiredGroups[g] = true
+		}
+		switch {
+		case u.PrimaryGroup != "":
+			desiredGroups[u.PrimaryGroup] = true
+		case db.Passwd.LookupLogin(u.Login) == nil:
+			desiredGroups[u.Login] = true
+		}
+	}
+
+	var removeGroups []Action
+	if ds.ManagedUsers != nil {
+		for _, pe := range db.Passwd.lines {
+			if pe.Compat() == CompatNone && !desiredUsers[pe.Login] && ds.ManagedUsers(pe) {
+				remove = append(remove, Action{Kind: ActionDeleteUser, Name: pe.Login})
+			}
+		}
+	}
+	if ds.ManagedGroups != nil {
+		removed := make(map[string]bool)
+		for _, a := range remove {
+			removed[a.Name] = true
+		}
+		for _, ge := range db.Group.lines {
+			if ge.Compat() != CompatNone || desiredGroups[ge.Name] || !ds.ManagedGroups(ge) {
+				continue
+			}
+			// The primary groups of desired users are desired
+			// along with them.
+			if user := db.primaryUser(ge.GID, removed); user != "" {
+				if !desiredUsers[user] {
+					skip = append(skip, Action{Kind: ActionSkipGroup, Name: ge.Name, Reason: "primary group of " + user})
+				}
+				continue
+			}
+			removeGroups = append(removeGroups, Action{Kind: ActionDeleteGroup, Name: ge.Name})
+		}
+	}
+
+	p := &Plan{Actions: []Action{}}
+	p.Actions = append(p.Actions, create...)
+	p.Actions = append(p.Actions, modify...)
+	p.Actions = append(p.Actions, createUsers...)
+	p.Actions = append(p.Actions, modifyUsers...)
+	p.Actions = append(p.Actions, remove...)
+	p.Actions = append(p.Actions, removeGroups...)
+	p.Actions = append(p.Actions, skip...)
+	return p, nil
+}
+
+// Apply carries out the plan.  It stops at the first action that
+// fails, leaving the actions before it applied, so it should be used
+// within a transaction that can be rolled back.
+func (p *Plan) Apply(db *DB) error {
+	for _, a := range p.Actions {
+		if err := db.apply(a); err != nil {
+			return fmt.Errorf("%s %s: %w", a.Kind, a.Name, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) apply(a Action) error {
+	switch a.Kind {
+	case ActionCreateGroup:
+		g := a.group
+		_, err := db.AddGroup(NewGroup{Name: g.Name, GID: g.GID, HasGID: g.HasGID, System: g.System})
+		return err
+	case ActionModifyGroup:
+		return db.ModifyGroup(a.Name, GroupMod{GID: &a.group.GID})
+	case ActionCreateUser:
+		u := a.user
+		nu := NewUser{
+			Login:        u.Login,
+			Password:     u.Password,
+			UID:          u.UID,
+			HasUID:       u.HasUID,
+			System:       u.System,
+			Comment:      u.Comment,
+			Home:         u.Home,
+			Shell:        u.Shell,
+			PrimaryGroup: u.PrimaryGroup,
+			Groups:       u.Groups,
+		}
+		if nu.PrimaryGroup == "" && db.Group.LookupName(u.Login) != nil {
+			nu.PrimaryGroup = u.Login
+		}
+		_, err := db.AddUser(nu)
+		return err
+	case ActionModifyUser:
+		u := a.user
+		m := UserMod{}
+		for _, c := range a.Changes {
+			switch c.Field {
+			case "password":
+				m.Password = &u.Password
+			case "uid":
+				m.UID = &u.UID
+			case "comment":
+				m.Comment = &u.Comment
+			case "home":
+				m.Home = &u.Home
+			case "shell":
+				m.Shell = &u.Shell
+			case "primary-group":
+				m.PrimaryGroup = &u.PrimaryGroup
+			case "groups":
+				m.Groups = &u.Groups
+			}
+		}
+		return db.ModifyUser(a.Name, m)
+	case ActionDeleteUser:
+		// The user private group is left to its own action, if
+		// it is owned.
+		return db.deleteUser(a.Name, false)
+	case ActionDeleteGroup:
+		return db.DeleteGroup(a.Name, false)
+	}
+	return nil
+}
+
+// userChanges lists the fields of pe that differ from u.
+func (db *DB) userChanges(pe *PasswdEntry, u *DesiredUser) []FieldChange {
+	changes := []FieldChange{}
+	change := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, FieldChange{field, redactField(field, old), redactField(field, new)})
+		}
+	}
+
+	if u.Password != "" {
+		current := pe.Password
+		if db.Shadow != nil {
+			if se := db.Shadow.LookupLogin(pe.Login); se != nil {
+				current = se.Password
+			}
+		}
+		change("password", current, u.Password)
+	}
+	if u.HasUID {
+		change("uid", strconv.Itoa(pe.UID), strconv.Itoa(u.UID))
+	}
+	if u.Comment != "" {
+		change("comment", pe.Comment, u.Comment)
+	}
+	if u.Home != "" {
+		change("home", pe.Home, u.Home)
+	}
+	if u.Shell != "" {
+		change("shell", pe.Shell, u.Shell)
+	}
+	if u.PrimaryGroup != "" {
+		current := strconv.Itoa(pe.GID)
+		if ge := db.Group.LookupGID(pe.GID); ge != nil {
+			current = ge.Name
+		}
+		change("primary-group", current, u.PrimaryGroup)
+	}
+	if u.Groups != nil {
+		current := []string{}
+		for _, ge := range db.Group.lines {
+			if ge.Compat() == CompatNone && contains(ge.UserList, pe.Login) {
+				current = append(current, ge.Name)
+			}
+		}
+		if !sameSet(current, u.Groups) {
+			change("groups", strings.Join(current, ","), strings.Join(u.Groups, ","))
+		}
+	}
+	return changes
+}
+
+// primaryUser returns a user other than those in removed whose
+// primary group is gid, or the empty string if there is none.
+func (db *DB) primaryUser(gid int, removed map[string]bool) string {
+	for _, pe := range db.Passwd.lines {
+		if pe.Compat() == CompatNone && pe.GID == gid && !removed[pe.Login] {
+			return pe.Login
+		}
+	}
+	return ""
+}
+
+// checkDesired checks that the desired state can be reached.
+func (db *DB) checkDesired(ds DesiredState) error {
+	groups := make(map[string]bool)
+	for _, g := range ds.Groups {
+		if groups[g.Name] {
+			return fmt.Errorf("%w: group %s is desired twice", ErrInconsistent, g.Name)
+		}
+		groups[g.Name] = true
+		if err := (&GroupEntry{Name: g.Name, GID: g.GID}).Validate(ds.ValidateOptions...); err != nil {
+			return err
+		}
+		if db.Group.LookupName(g.Name) == nil {
+			if err := db.checkNewName(g.Name); err != nil {
+				return err
+			}
+		}
+	}
+	exists := func(name string) bool {
+		return groups[name] || db.Group.LookupName(name) != nil
+	}
+
+	users := make(map[string]bool)
+	for _, u := range ds.Users {
+		if users[u.Login] {
+			return fmt.Errorf("%w: user %s is desired twice", ErrInconsistent, u.Login)
+		}
+		users[u.Login] = true
+		pe := &PasswdEntry{Login: u.Login, Password: u.Password, UID: u.UID, Comment: u.Comment, Home: u.Home, Shell: u.Shell}
+		if err := pe.Validate(ds.ValidateOptions...); err != nil {
+			return err
+		}
+		if db.Passwd.LookupLogin(u.Login) == nil {
+			if err := db.checkNewName(u.Login); err != nil {
+				return err
+			}
+		}
+		if u.Shell != "" {
+			if err := db.checkShell(u.Shell); err != nil {
+				return err
+			}
+		}
+		if u.PrimaryGroup != "" && !exists(u.PrimaryGroup) {
+			return fmt.Errorf("%w: %s", ErrNoSuchGroup, u.PrimaryGroup)
+		}
+		for _, g := range u.Groups {
+			if !exists(g) {
+				return fmt.Errorf("%w: %s", ErrNoSuchGroup, g)
+			}
+		}
+	}
+	return nil
+}
+
+// sameSet reports if a and b hold the same strings, in any order.
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, s := range a {
+		if !contains(b, s) {
+			return false
+		}
+	}
+	for _, s := range b {
+		if !contains(a, s) {
+			return false
+		}
+	}
+	return true
+}
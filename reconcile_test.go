@@ -0,0 +1,245 @@
+package shadow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	db := newTestDB(t)
+	ds := DesiredState{
+		Users: []DesiredUser{
+			{Login: "maldridge", Shell: "/bin/zsh", Groups: []string{"kvm"}},
+			{Login: "foo", Password: "$6$salt$hash", Groups: []string{"wheel"}},
+			{Login: "root", Shell: "/bin/zsh"},
+		},
+		Groups:        []DesiredGroup{{Name: "kvm"}},
+		ManagedUsers:  PasswdUID(AtLeast(1000)),
+		ManagedGroups: GroupGID(AtLeast(1000)),
+	}
+
+	p, err := db.Reconcile(ds, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "create-group kvm\n" +
+		"create-user foo\n" +
+		"modify-user maldridge: shell \"/bin/bash\" -> \"/bin/zsh\", groups \"wheel\" -> \"kvm\"\n" +
+		"skip-user root: not managed\n"
+	if p.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", p, want)
+	}
+	if db.Passwd.LookupLogin("foo") != nil || db.Group.LookupName("kvm") != nil {
+		t.Error("Dry run changed the databases")
+	}
+
+	if _, err := db.Reconcile(ds, false); err != nil {
+		t.Fatal(err)
+	}
+	if pe := db.Passwd.LookupLogin("maldridge"); pe.Shell != "/bin/zsh" {
+		t.Errorf("Got %v", pe)
+	}
+	if pe := db.Passwd.LookupLogin("root"); pe.Shell != "/bin/sh" {
+		t.Errorf("Unmanaged user changed: %v", pe)
+	}
+	if se := db.Shadow.LookupLogin("foo"); se == nil || se.Password != "$6$salt$hash" {
+		t.Errorf("Got %v", se)
+	}
+	if ge := db.Group.LookupName("wheel"); !contains(ge.UserList, "foo") || contains(ge.UserList, "maldridge") {
+		t.Errorf("Got %v", ge)
+	}
+	if err := db.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	p, err = db.Plan(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Empty() {
+		t.Errorf("Plan not empty after applying:\n%s", p)
+	}
+}
+
+func TestReconcileRemove(t *testing.T) {
+	db := newTestDB(t)
+	ds := DesiredState{
+		Groups:        []DesiredGroup{{Name: "ops", GID: 2000, HasGID: true}},
+		ManagedUsers:  PasswdUID(AtLeast(1000)),
+		ManagedGroups: GroupGID(AtLeast(1000)),
+	}
+
+	p, err := db.Reconcile(ds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "create-group ops\ndelete-user maldridge\ndelete-group maldridge\n"
+	if p.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", p, want)
+	}
+	if db.Passwd.LookupLogin("maldridge") != nil || db.Group.LookupName("maldridge") != nil {
+		t.Error("maldridge was not removed")
+	}
+	if ge := db.Group.LookupName("ops"); ge == nil || ge.GID != 2000 {
+		t.Errorf("Got %v", ge)
+	}
+
+	// A user private group that is not owned stays.
+	db = newTestDB(t)
+	p, err = db.Reconcile(DesiredState{ManagedUsers: PasswdUID(AtLeast(1000))}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "delete-user maldridge\n"; p.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", p, want)
+	}
+	if db.Group.LookupName("maldridge") == nil {
+		t.Error("Group maldridge was removed")
+	}
+
+	// Without ownership markers nothing is removed.
+	db = newTestDB(t)
+	p, err = db.Plan(DesiredState{})
+	if err != nil || !p.Empty() {
+		t.Errorf("Got %v, %v", p, err)
+	}
+}
+
+func TestReconcilePrimaryGroup(t *testing.T) {
+	db := newTestDB(t)
+	ds := DesiredState{
+		Users:         []DesiredUser{{Login: "maldridge"}},
+		ManagedGroups: GroupGID(AtLeast(1000)),
+	}
+
+	// The user private group of a desired user is kept silently.
+	p, err := db.Plan(ds)
+	if err != nil || len(p.Actions) != 0 {
+		t.Errorf("Got %v, %v", p, err)
+	}
+
+	// A group that an account outside the inventory depends on is
+	// kept with a reason.
+	ds.Users = nil
+	p, err = db.Plan(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "skip-group maldridge: primary group of maldridge\n"
+	if p.String() != want || !p.Empty() {
+		t.Errorf("Got:\n%s\nWant:\n%s", p, want)
+	}
+}
+
+func TestReconcileUsedGroups(t *testing.T) {
+	cases := []struct {
+		u    DesiredUser
+		want string
+	}{
+		{DesiredUser{Login: "foo", PrimaryGroup: "dev"}, "create-user foo\n"},
+		{DesiredUser{Login: "maldridge", Groups: []string{"dev"}}, "modify-user maldridge: groups \"wheel\" -> \"dev\"\n"},
+		{DesiredUser{Login: "dev"}, "create-user dev\n"},
+	}
+
+	// Groups that desired users are given are not removed.
+	for i, c := range cases {
+		db := newTestDB(t)
+		if _, err := db.AddGroup(NewGroup{Name: "dev", GID: 2000, HasGID: true}); err != nil {
+			t.Fatal(err)
+		}
+		ds := DesiredState{
+			Users:         []DesiredUser{c.u},
+			ManagedGroups: GroupGID(AtLeast(2000)),
+		}
+		p, err := db.Reconcile(ds, false)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if p.String() != c.want {
+			t.Errorf("%d: Got:\n%s\nWant:\n%s", i, p, c.want)
+		}
+		if db.Group.LookupName("dev") == nil {
+			t.Errorf("%d: Group dev was removed", i)
+		}
+		if p, err := db.Plan(ds); err != nil || !p.Empty() {
+			t.Errorf("%d: Did not converge: %v, %v", i, p, err)
+		}
+	}
+}
+
+func TestReconcileInvalid(t *testing.T) {
+	db := newTestDB(t)
+	cases := []struct {
+		ds   DesiredState
+		want error
+	}{
+		{DesiredState{Users: []DesiredUser{{Login: "foo"}, {Login: "foo"}}}, ErrInconsistent},
+		{DesiredState{Groups: []DesiredGroup{{Name: "ops"}, {Name: "ops"}}}, ErrInconsistent},
+		{DesiredState{Users: []DesiredUser{{Login: "foo", Groups: []string{"ops"}}}}, ErrNoSuchGroup},
+		{DesiredState{Users: []DesiredUser{{Login: "foo", PrimaryGroup: "ops"}}}, ErrNoSuchGroup},
+		{DesiredState{Users: []DesiredUser{{Login: "foo:bar"}}}, ErrInvalidCharacter},
+		{DesiredState{Users: []DesiredUser{{Login: "foo", Password: "x:0:0:99999:7:::\nroot2::0:0"}}}, ErrInvalidCharacter},
+		{DesiredState{Users: []DesiredUser{{Login: "Debian-exim"}}}, ErrInvalidName},
+	}
+
+	for i, c := range cases {
+		if _, err := db.Reconcile(c.ds, false); !errors.Is(err, c.want) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.want)
+		}
+	}
+	if db.Passwd.LookupLogin("foo") != nil || db.Shadow.LookupLogin("root2") != nil {
+		t.Error("Invalid state was applied")
+	}
+
+	// Existing accounts may be listed under other rules, but new
+	// names must follow the rules of the DB.
+	db.Passwd.Add([]*PasswdEntry{{Login: "Debian-exim", Password: "x", UID: 101, GID: 101, Shell: "/bin/false"}})
+	db.Shadow.Add([]*ShadowEntry{{Login: "Debian-exim", Password: "!"}})
+	ds := DesiredState{
+		Users:           []DesiredUser{{Login: "Debian-exim", Home: "/var/spool/exim4"}},
+		ValidateOptions: []ValidateOption{WithNameRules(NameRulesRelaxed)},
+	}
+	if _, err := db.Reconcile(ds, false); err != nil {
+		t.Error(err)
+	}
+	ds.Users = append(ds.Users, DesiredUser{Login: "Exim-New"})
+	if _, err := db.Plan(ds); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidName)
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	db := newTestDB(t)
+	p, err := db.Plan(DesiredState{
+		Users: []DesiredUser{{Login: "maldridge", Password: "$6$salt$hash"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := new(strings.Builder)
+	if err := p.WriteJSON(b); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "actions": [
+    {
+      "action": "modify-user",
+      "name": "maldridge",
+      "changes": [
+        {
+          "field": "password",
+          "old": "!",
+          "new": "<redacted>"
+        }
+      ]
+    }
+  ]
+}
+`
+	if b.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", b, want)
+	}
+}
@@ -0,0 +1,245 @@
+package shadow
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// These are the buckets that an ExpiryReport sorts entries into.
+const (
+	BucketExpired  = "expired"
+	BucketInactive = "inactive"
+	BucketWarning  = "warning"
+	BucketNever    = "never"
+)
+
+// reportBuckets is the order in which buckets are written.
+var reportBuckets = []string{BucketExpired, BucketInactive, BucketWarning, BucketNever}
+
+// A ReportEntry describes the expiry of one account in an
+// ExpiryReport.
+type ReportEntry struct {
+	Login string
+
+	// UID and Comment come from the passwd database.  UID is -1
+	// if the user has no passwd entry.
+	UID     int
+	Comment string
+
+	Bucket string
+
+	// What is "password" or "account" depending on what expires
+	// first, and Expires is the day on which it does.  Both are
+	// unset for accounts that never expire, and for passwords
+	// that must be changed at the next login.
+	What       string
+	Expires    time.Time
+	HasExpires bool
+
+	// DaysLeft is the number of days until Expires, which is
+	// negative if it has already passed.
+	DaysLeft int
+}
+
+// An ExpiryReport lists accounts that have expired or will expire
+// within a number of days.
+type ExpiryReport struct {
+	Now     time.Time
+	Days    int
+	Entries []ReportEntry
+}
+
+// NewExpiryReport examines every entry in sm as of now.  Accounts
+// that are already expired or inactive, that will expire within the
+// given number of days, or that never expire are placed in the
+// matching bucket.  Accounts that expire later are left out.  A
+// password that is inside its warning period is always reported as
+// in warning.  The UID and comment of each user are taken from pm,
+// which may be nil.
+func NewExpiryReport(sm *ShadowMap, pm *PasswdMap, now time.Time, days int) *ExpiryReport {
+	r := &ExpiryReport{Now: dayOf(now), Days: days, Entries: []ReportEntry{}}
+	for _, se := range sm.lines {
+		if compatKind(se.Login) != CompatNone {
+			continue
+		}
+		re := ReportEntry{Login: se.Login, UID: -1}
+		if pm != nil {
+			if pe := pm.LookupLogin(se.Login); pe != nil {
+				re.UID = pe.UID
+				re.Comment = pe.Comment
+			}
+		}
+
+		a := se.Aging()
+		if a.HasPasswordExpires {
+			re.What = "password"
+			re.Expires = a.PasswordExpires
+			re.HasExpires = true
+		}
+		if a.HasAccountExpires && a.AccountExpires.After(epochStart) &&
+			(!re.HasExpires || a.AccountExpires.Before(re.Expires)) {
+			re.What = "account"
+			re.Expires = a.AccountExpires
+			re.HasExpires = true
+		}
+		if re.HasExpires {
+			re.DaysLeft = dayNumber(re.Expires) - dayNumber(now)
+		}
+
+		switch se.Expired(now) {
+		case ExpiryAccount:
+			re.Bucket = BucketExpired
+			re.What = "account"
+			re.Expires = a.AccountExpires
+			re.DaysLeft = dayNumber(re.Expires) - dayNumber(now)
+		case ExpiryPassword:
+			re.Bucket = BucketExpired
+			if a.MustChange {
+				re.What = "password"
+				re.HasExpires = false
+			}
+		case ExpiryInactive:
+			re.Bucket = BucketInactive
+			re.What = "password"
+			if a.HasPasswordInactive {
+				re.Expires = a.PasswordInactive
+				re.DaysLeft = dayNumber(re.Expires) - dayNumber(now)
+			}
+		default:
+			switch {
+			case !re.HasExpires:
+				re.Bucket = BucketNever
+			case re.DaysLeft <= days, se.InWarning(now):
+				re.Bucket = BucketWarning
+			default:
+				continue
+			}
+		}
+		r.Entries = append(r.Entries, re)
+	}
+	return r
+}
+
+// Bucket returns the entries in the named bucket.
+func (r *ExpiryReport) Bucket(name string) []ReportEntry {
+	out := []ReportEntry{}
+	for _, e := range r.Entries {
+		if e.Bucket == name {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// sorted returns the entries ordered by bucket, and by their order in
+// the shadow database within a bucket.
+func (r *ExpiryReport) sorted() []ReportEntry {
+	out := []ReportEntry{}
+	for _, b := range reportBuckets {
+		out = append(out, r.Bucket(b)...)
+	}
+	return out
+}
+
+func (e ReportEntry) expiresString() string {
+	if !e.HasExpires {
+		return ""
+	}
+	return e.Expires.Format("2006-01-02")
+}
+
+// WriteText writes the report as a table grouped by bucket, suitable
+// for reading by a person.
+func (r *ExpiryReport) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Expiry report for %s, next %d days\n", r.Now.Format("2006-01-02"), r.Days)
+	for _, b := range reportBuckets {
+		entries := r.Bucket(b)
+		fmt.Fprintf(w, "\n%s (%d)\n", b, len(entries))
+		if len(entries) == 0 {
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  LOGIN\tUID\tEXPIRES\tDAYS\tWHAT\tCOMMENT")
+		for _, e := range entries {
+			days := ""
+			if e.HasExpires {
+				days = strconv.Itoa(e.DaysLeft)
+			}
+			fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\t%s\t%s\n",
+				e.Login, e.UID, e.expiresString(), days, e.What, e.Comment)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the report as CSV with a header row.
+func (r *ExpiryReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"bucket", "login", "uid", "comment", "what", "expires", "days_left"})
+	for _, e := range r.sorted() {
+		days := ""
+		if e.HasExpires {
+			days = strconv.Itoa(e.DaysLeft)
+		}
+		cw.Write([]string{
+			e.Bucket,
+			e.Login,
+			strconv.Itoa(e.UID),
+			e.Comment,
+			e.What,
+			e.expiresString(),
+			days,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type jsonReportEntry struct {
+	Bucket   string `json:"bucket"`
+	Login    string `json:"login"`
+	UID      int    `json:"uid"`
+	Comment  string `json:"comment,omitempty"`
+	What     string `json:"what,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	DaysLeft *int   `json:"days_left,omitempty"`
+}
+
+// WriteJSON writes the report as a JSON object.
+func (r *ExpiryReport) WriteJSON(w io.Writer) error {
+	out := struct {
+		Date    string            `json:"date"`
+		Days    int               `json:"days"`
+		Entries []jsonReportEntry `json:"entries"`
+	}{
+		Date:    r.Now.Format("2006-01-02"),
+		Days:    r.Days,
+		Entries: []jsonReportEntry{},
+	}
+	for _, e := range r.sorted() {
+		je := jsonReportEntry{
+			Bucket:  e.Bucket,
+			Login:   e.Login,
+			UID:     e.UID,
+			Comment: e.Comment,
+			What:    e.What,
+			Expires: e.expiresString(),
+		}
+		if e.HasExpires {
+			days := e.DaysLeft
+			je.DaysLeft = &days
+		}
+		out.Entries = append(out.Entries, je)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,121 @@
+package shadow
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTestReport(t *testing.T) *ExpiryReport {
+	// Day 18000 is 2019-04-14.
+	sm, err := ParseShadowMap(strings.NewReader(`root:*:18000:0:99999:7:::
+old:$6$salt$hash:18000:0:90:7:10::
+stale:$6$salt$hash:18000:0:90:7:::
+soon:$6$salt$hash:18000:0:90:7:::
+gone:$6$salt$hash:18000:0:99999:7::17900:
+fresh:$6$salt$hash:18100:0:90:7:::
+forced:$6$salt$hash:0:0:90:7:::
+nopasswd:$6$salt$hash::::::18200:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := ParsePasswdMap(strings.NewReader(`root:x:0:0:root:/root:/bin/sh
+soon:x:1000:1000:Soon Expiring:/home/soon:/bin/sh
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The passwords of old and stale expired on 2019-07-13, and
+	// old became inactive on 2019-07-23.
+	return NewExpiryReport(sm, pm, day("2019-07-10"), 3)
+}
+
+func TestExpiryReport(t *testing.T) {
+	sm, _ := ParseShadowMap(strings.NewReader("old:x:18000:0:90:7:10::\nstale:x:18000:0:90:7:::\n"))
+	r := NewExpiryReport(sm, nil, day("2019-07-25"), 3)
+	if got := r.Bucket(BucketInactive); len(got) != 1 || got[0].Login != "old" || got[0].DaysLeft != -2 {
+		t.Errorf("Inactive: Got %v", got)
+	}
+	if got := r.Bucket(BucketExpired); len(got) != 1 || got[0].Login != "stale" || got[0].DaysLeft != -12 {
+		t.Errorf("Expired: Got %v", got)
+	}
+
+	r = newTestReport(t)
+	cases := []struct {
+		bucket string
+		want   string
+	}{
+		{BucketExpired, "gone forced"},
+		{BucketInactive, ""},
+		{BucketWarning, "old stale soon"},
+		{BucketNever, "root"},
+	}
+	for _, c := range cases {
+		logins := []string{}
+		for _, e := range r.Bucket(c.bucket) {
+			logins = append(logins, e.Login)
+		}
+		if got := strings.Join(logins, " "); got != c.want {
+			t.Errorf("%s: Got %q; Want %q", c.bucket, got, c.want)
+		}
+	}
+
+	soon := r.Bucket(BucketWarning)[2]
+	if soon.UID != 1000 || soon.Comment != "Soon Expiring" || soon.DaysLeft != 3 || soon.What != "password" {
+		t.Errorf("Got %+v", soon)
+	}
+	if gone := r.Bucket(BucketExpired)[0]; gone.What != "account" || gone.DaysLeft != -187 || gone.UID != -1 {
+		t.Errorf("Got %+v", gone)
+	}
+}
+
+func TestExpiryReportFormats(t *testing.T) {
+	r := newTestReport(t)
+
+	buf := new(bytes.Buffer)
+	if err := r.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `bucket,login,uid,comment,what,expires,days_left
+expired,gone,-1,,account,2019-01-04,-187
+expired,forced,-1,,password,,
+warning,old,-1,,password,2019-07-13,3
+warning,stale,-1,,password,2019-07-13,3
+warning,soon,1000,Soon Expiring,password,2019-07-13,3
+never,root,0,root,,,
+`
+	if buf.String() != want {
+		t.Errorf("Got:\n%s\nWant:\n%s", buf, want)
+	}
+
+	buf.Reset()
+	if err := r.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Date    string
+		Entries []map[string]interface{}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Date != "2019-07-10" || len(out.Entries) != 6 {
+		t.Errorf("Got %s", buf)
+	}
+	if _, ok := out.Entries[1]["days_left"]; ok {
+		t.Errorf("forced: Got days_left in %v", out.Entries[1])
+	}
+
+	buf.Reset()
+	if err := r.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"expired (2)", "inactive (0)", "  soon   1000  2019-07-13  3     password  Soon Expiring"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("Missing %q in:\n%s", s, buf)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package shadow
 
 import (
-	"bufio"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -16,6 +16,13 @@ func init() {
 	epochStart, _ = time.Parse("2006-01-02", "1970-01-01")
 }
 
+// dayOf truncates t to the start of its day, which is the resolution
+// that all dates in the shadow database are stored with.
+func dayOf(t time.Time) time.Time {
+	days := int(t.UTC().Sub(epochStart).Hours() / 24)
+	return epochStart.Add(time.Hour * 24 * time.Duration(days))
+}
+
 // A ShadowEntry is a single entry in the shadow database.  The entry
 // uses the field names as found in `man 5 shadow`.
 type ShadowEntry struct {
@@ -56,39 +63,76 @@ func (se ShadowEntry) String() string {
 		se.Reserved
 }
 
-// Parse converts a string to a ShadowEntry.
-func (se *ShadowEntry) Parse(s string) error {
+// shadowFields names the fields of a ShadowEntry for errors.
+var shadowFields = []string{"login", "password", "lastchg", "min", "max", "warn", "inact", "expire", "reserved"}
+
+// Parse converts a string to a ShadowEntry.  Empty numeric fields are
+// unset, and any other value, including -1, is kept as it is.  By
+// default a field that is not a number is read as 0.  With the
+// Strict option such fields are rejected with ErrNotANumber, and
+// negative values with ErrNegativeValue, as they are by shadow-utils.
+func (se *ShadowEntry) Parse(s string, opts ...ParseOption) error {
+	o := newParseOptions(opts)
+
 	fields := strings.Split(s, ":")
 	if len(fields) != 9 {
-		return ErrWrongNumFields
+		return recordError(ErrWrongNumFields)
+	}
+
+	num := func(i int) (int, bool, error) {
+		if fields[i] == "" {
+			return 0, false, nil
+		}
+		n, err := strconv.Atoi(fields[i])
+		if !o.strict {
+			return n, true, nil
+		}
+		if err != nil {
+			return 0, false, fieldError(shadowFields, i, ErrNotANumber)
+		}
+		if n < 0 {
+			return 0, false, fieldError(shadowFields, i, ErrNegativeValue)
+		}
+		return n, true, nil
+	}
+
+	var nums [6]int
+	var has [6]bool
+	for i := range nums {
+		var err error
+		nums[i], has[i], err = num(i + 2)
+		if err != nil {
+			*se = ShadowEntry{}
+			return err
+		}
+	}
+	if o.strict && fields[8] != "" {
+		if _, err := strconv.ParseUint(fields[8], 10, 64); err != nil {
+			*se = ShadowEntry{}
+			return fieldError(shadowFields, 8, ErrNotANumber)
+		}
 	}
 
 	se.Login = fields[0]
 	se.Password = fields[1]
 
-	lcdays, _ := strconv.Atoi(fields[2])
-	se.LastChanged = epochStart.Add(time.Hour * 24 * time.Duration(lcdays))
-	se.HasLastChanged = len(fields[2]) != 0
+	se.LastChanged = epochStart.Add(time.Hour * 24 * time.Duration(nums[0]))
+	se.HasLastChanged = has[0]
 
-	minAge, _ := strconv.Atoi(fields[3])
-	se.MinimumPasswordAge = minAge
-	se.HasMinimumPasswordAge = len(fields[3]) != 0
+	se.MinimumPasswordAge = nums[1]
+	se.HasMinimumPasswordAge = has[1]
 
-	maxAge, _ := strconv.Atoi(fields[4])
-	se.MaximumPasswordAge = maxAge
-	se.HasMaximumPasswordAge = len(fields[4]) != 0
+	se.MaximumPasswordAge = nums[2]
+	se.HasMaximumPasswordAge = has[2]
 
-	warningDays, _ := strconv.Atoi(fields[5])
-	se.WarningDays = warningDays
-	se.HasWarningDays = len(fields[5]) != 0
+	se.WarningDays = nums[3]
+	se.HasWarningDays = has[3]
 
-	inactivityDays, _ := strconv.Atoi(fields[6])
-	se.InactivityDays = inactivityDays
-	se.HasInactivityDays = len(fields[6]) != 0
+	se.InactivityDays = nums[4]
+	se.HasInactivityDays = has[4]
 
-	expirationDays, _ := strconv.Atoi(fields[7])
-	se.Expiration = epochStart.Add(time.Hour * 24 * time.Duration(expirationDays))
-	se.HasExpiration = len(fields[7]) != 0
+	se.Expiration = epochStart.Add(time.Hour * 24 * time.Duration(nums[5]))
+	se.HasExpiration = has[5]
 
 	se.Reserved = fields[8]
 
@@ -99,40 +143,66 @@ func (se *ShadowEntry) Parse(s string) error {
 // written and used for authentication by a host.
 type ShadowMap struct {
 	lines []*ShadowEntry
+	raw   preserved
+
+	// byLogin indexes the entries for lookups.  It is built on the
+	// first lookup and discarded by Del.
+	byLogin map[string]*ShadowEntry
 }
 
 func (sm ShadowMap) String() string {
 	out := new(strings.Builder)
 	for _, l := range sm.lines {
-		out.WriteString(l.String())
-		out.WriteRune('\n')
+		sm.raw.write(out, l, l.String())
 	}
-	return out.String()
+	return sm.raw.end(out)
+}
+
+// WriteFile atomically replaces the shadow database at path with the
+// contents of the map.  The global and per-file locks are held for
+// the duration of the write.
+func (sm *ShadowMap) WriteFile(path string) error {
+	return writeLocked(path, []byte(sm.String()), 0640)
 }
 
 // ParseShadowMap parses the values from r and converts it to a
 // ShadowMap for further manipulation.
-func ParseShadowMap(r io.Reader) (*ShadowMap, error) {
-	lines := []*ShadowEntry{}
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
+func ParseShadowMap(r io.Reader, opts ...ParseOption) (*ShadowMap, error) {
+	sm := &ShadowMap{lines: []*ShadowEntry{}}
+	err := parseLines(r, opts, &sm.raw, func(s string) (fmt.Stringer, error) {
 		t := new(ShadowEntry)
-		if err := t.Parse(scanner.Text()); err != nil {
+		if err := t.Parse(s, opts...); err != nil {
 			return nil, err
 		}
-		lines = append(lines, t)
+		sm.lines = append(sm.lines, t)
+		return t, nil
+	})
+	if !keepMap(err) {
+		return nil, err
 	}
-	sm := new(ShadowMap)
-	sm.lines = lines
-	return sm, nil
+	return sm, err
 }
 
 // FilterLogin applies a StringFilter to the Login field of all loaded
 // ShadowEntry's and returns a list of all entries that matched.
+func (sm *ShadowMap) FilterLogin(f StringFilter) []*ShadowEntry {
+	return sm.Filter(ShadowLogin(f))
+}
+
+// FilterUID is FilterLogin under the name it was first given.
+//
+// Deprecated: FilterUID filters on Login, not on a UID, which shadow
+// entries do not have.  Use FilterLogin instead.
 func (sm *ShadowMap) FilterUID(f StringFilter) []*ShadowEntry {
+	return sm.FilterLogin(f)
+}
+
+// Filter applies a ShadowFilter to all loaded ShadowEntry's and
+// returns a list of all entries that matched.
+func (sm *ShadowMap) Filter(f ShadowFilter) []*ShadowEntry {
 	nl := []*ShadowEntry{}
 	for _, l := range sm.lines {
-		if !f(l.Login) {
+		if !f(l) {
 			// Filter did not match.
 			continue
 		}
@@ -145,6 +215,9 @@ func (sm *ShadowMap) FilterUID(f StringFilter) []*ShadowEntry {
 // enforced.
 func (sm *ShadowMap) Add(a []*ShadowEntry) {
 	sm.lines = append(sm.lines, a...)
+	if sm.byLogin != nil {
+		sm.indexEntries(a)
+	}
 }
 
 // Del iterates through the provided list and removes entities that
@@ -164,11 +237,53 @@ func (sm *ShadowMap) Del(d []*ShadowEntry) {
 		if doTest && *l == *e {
 			// The entity is an exact match and should be
 			// removed.
+			sm.raw.drop(l)
 			continue
 		}
 		// The entity is not an exact match, and should be
 		// retained.
+		sm.raw.keep(l)
 		out = append(out, l)
 	}
+	sm.raw.flush()
 	sm.lines = out
+	sm.Reindex()
+}
+
+// LookupLogin returns the entry for login, or nil if there isn't
+// one.  Reindex must be called after changing the login of an entry
+// in place, or lookups of the new login will not find it.
+func (sm *ShadowMap) LookupLogin(login string) *ShadowEntry {
+	if se := sm.index().byLogin[login]; se == nil || se.Login == login {
+		return se
+	}
+	// The entry was renamed since the index was built.
+	sm.Reindex()
+	return sm.index().byLogin[login]
+}
+
+// index builds the index if it is not already built.
+func (sm *ShadowMap) index() *ShadowMap {
+	if sm.byLogin == nil {
+		sm.byLogin = make(map[string]*ShadowEntry, len(sm.lines))
+		sm.indexEntries(sm.lines)
+	}
+	return sm
+}
+
+// indexEntries adds entries to the index, keeping any existing entry
+// with the same login as it comes first.
+func (sm *ShadowMap) indexEntries(entries []*ShadowEntry) {
+	for _, l := range entries {
+		if _, ok := sm.byLogin[l.Login]; !ok {
+			sm.byLogin[l.Login] = l
+		}
+	}
+}
+
+// Reindex discards the lookup index, which is rebuilt by the next
+// lookup.  It must be called after the login of an entry is changed
+// in place.
+func (sm *ShadowMap) Reindex() {
+	sm.byLogin = nil
 }
@@ -1,6 +1,7 @@
 package shadow
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -59,7 +60,7 @@ func TestParseShadowEntry(t *testing.T) {
 
 	for i, c := range cases {
 		se := new(ShadowEntry)
-		if err := se.Parse(c.line); err != c.wantErr {
+		if err := se.Parse(c.line); !errors.Is(err, c.wantErr) {
 			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
 		}
 		if *se != c.wantEntry {
@@ -104,7 +105,7 @@ func TestParseShadowMap(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		if _, err := ParseShadowMap(c.r); err != c.wantErr {
+		if _, err := ParseShadowMap(c.r); !errors.Is(err, c.wantErr) {
 			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
 		}
 	}
@@ -122,7 +123,7 @@ func TestFilterLogin(t *testing.T) {
 		},
 	}
 
-	res := pm.FilterUID(func(s string) bool { return s == "login2" })
+	res := pm.FilterLogin(func(s string) bool { return s == "login2" })
 	if len(res) != 1 || res[0].Login != "login2" {
 		t.Error("Filter applied incorrectly!")
 	}
@@ -162,3 +163,82 @@ func TestShadowDel(t *testing.T) {
 		t.Error("Incorrect delete")
 	}
 }
+
+func TestParseShadowEntryStrict(t *testing.T) {
+	cases := []struct {
+		line      string
+		wantErr   error
+		wantField string
+	}{
+		{"nobody:x:17518:0:99999:7:::", nil, ""},
+		{"nobody:x:abc:0:99999:7:::", ErrNotANumber, "lastchg"},
+		{"nobody:x:17518:0:99999:7::soon:", ErrNotANumber, "expire"},
+		{"nobody:x:17518:-1:99999:7:::", ErrNegativeValue, "min"},
+		{"nobody:x:17518:0:99999:7:::x", ErrNotANumber, "reserved"},
+	}
+
+	for i, c := range cases {
+		se := new(ShadowEntry)
+		err := se.Parse(c.line, Strict())
+		if !errors.Is(err, c.wantErr) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if pe, ok := err.(*ParseError); ok && pe.FieldName != c.wantField {
+			t.Errorf("%d: Got field %s; Want %s", i, pe.FieldName, c.wantField)
+		}
+
+		// Without Strict the same lines parse.
+		if err := se.Parse(c.line); err != nil {
+			t.Errorf("%d: Got %v without Strict", i, err)
+		}
+	}
+
+	if _, err := ParseShadowMap(strings.NewReader("nobody:x:abc:0:99999:7:::\n"), Strict()); !errors.Is(err, ErrNotANumber) {
+		t.Errorf("ParseShadowMap: Got %v; Want %v", err, ErrNotANumber)
+	}
+}
+
+func TestShadowEntryMinusOne(t *testing.T) {
+	line := "nobody:x:-1:-1:-1:-1:-1:-1:"
+	se := new(ShadowEntry)
+	if err := se.Parse(line); err != nil {
+		t.Fatal(err)
+	}
+	if !se.HasMaximumPasswordAge || se.MaximumPasswordAge != -1 {
+		t.Errorf("Got %d, %v; Want -1, true", se.MaximumPasswordAge, se.HasMaximumPasswordAge)
+	}
+	if se.String() != line {
+		t.Errorf("Got %s; Want %s", se, line)
+	}
+
+	// Aging treats -1 the same as an empty field.
+	if s := se.Expired(time.Now()); s != ExpiryNone {
+		t.Errorf("Got %v; Want %v", s, ExpiryNone)
+	}
+	if a := se.Aging(); a.HasLastChanged || a.HasAccountExpires {
+		t.Errorf("Got %+v", a)
+	}
+}
+
+func TestShadowLookup(t *testing.T) {
+	sm, err := ParseShadowMap(strings.NewReader("root:*:17518:0:99999:7:::\nmaldridge:!:17518:0:99999:7:::\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if se := sm.LookupLogin("maldridge"); se == nil || se.Password != "!" {
+		t.Errorf("Got %v", se)
+	}
+	sm.Add([]*ShadowEntry{{Login: "new"}})
+	if se := sm.LookupLogin("new"); se == nil {
+		t.Error("Added entry not found")
+	}
+	sm.Del([]*ShadowEntry{sm.LookupLogin("root")})
+	if se := sm.LookupLogin("root"); se != nil {
+		t.Errorf("Got %v after Del", se)
+	}
+	sm.LookupLogin("maldridge").Login = "mal"
+	sm.Reindex()
+	if se := sm.LookupLogin("mal"); se == nil || se.Password != "!" {
+		t.Errorf("Got %v after rename", se)
+	}
+}
@@ -0,0 +1,92 @@
+package shadow
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// ShellsFile is the default location of the list of valid login
+// shells.
+const ShellsFile = "/etc/shells"
+
+// defaultShells is what getusershell(3) uses when there is no
+// /etc/shells.
+var defaultShells = []string{"/bin/sh", "/bin/csh"}
+
+// Shells is the list of valid login shells read from shells(5).  A
+// nil *Shells behaves as a missing file, which allows only /bin/sh
+// and /bin/csh.  The methods that take a shell can be used as a
+// StringFilter, for example as CheckShell(shells.IsLoginShell).
+type Shells struct {
+	list []string
+	set  map[string]bool
+}
+
+// ParseShells reads the list of shells from r.  Each line holds the
+// path of one shell.  Blank lines and lines beginning with '#' are
+// ignored.
+func ParseShells(r io.Reader) (*Shells, error) {
+	s := &Shells{list: []string{}, set: make(map[string]bool)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !s.set[line] {
+			s.list = append(s.list, line)
+			s.set[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns the shells in the order they are listed.
+func (s *Shells) List() []string {
+	if s == nil {
+		return append([]string(nil), defaultShells...)
+	}
+	return append([]string(nil), s.list...)
+}
+
+// Contains reports if shell is listed.  An empty shell stands for
+// /bin/sh, as it does in the passwd database.
+func (s *Shells) Contains(shell string) bool {
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	if s == nil {
+		return shell == defaultShells[0] || shell == defaultShells[1]
+	}
+	return s.set[shell]
+}
+
+// IsLoginShell reports if shell is listed and allows an interactive
+// login, which nologin shells do not even if they are listed.
+func (s *Shells) IsLoginShell(shell string) bool {
+	return s.Contains(shell) && !s.IsNoLogin(shell)
+}
+
+// IsNoLogin reports if shell refuses logins, as nologin(8) and
+// false(1) do, wherever they are installed.  It does not depend on
+// the list.
+func (s *Shells) IsNoLogin(shell string) bool {
+	switch path.Base(shell) {
+	case "nologin", "false":
+		return true
+	default:
+		return false
+	}
+}
+
+// InteractiveUsers returns the users whose shell is a login shell
+// according to s, which are those that can log in interactively if
+// their password allows it.  Compat entries are not included.
+func (pm *PasswdMap) InteractiveUsers(s *Shells) []*PasswdEntry {
+	return pm.Filter(PasswdShell(s.IsLoginShell))
+}
@@ -0,0 +1,109 @@
+package shadow
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testShells = `# /etc/shells: valid login shells
+/bin/sh
+/bin/bash
+/usr/bin/zsh
+
+/usr/sbin/nologin
+/bin/bash
+`
+
+func TestParseShells(t *testing.T) {
+	s, err := ParseShells(strings.NewReader(testShells))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/bin/sh", "/bin/bash", "/usr/bin/zsh", "/usr/sbin/nologin"}
+	if !reflect.DeepEqual(s.List(), want) {
+		t.Errorf("Got %v; Want %v", s.List(), want)
+	}
+
+	cases := []struct {
+		shell   string
+		login   bool
+		nologin bool
+	}{
+		{"/bin/bash", true, false},
+		{"", true, false},
+		{"/bin/fish", false, false},
+		{"/usr/sbin/nologin", false, true},
+		{"/sbin/nologin", false, true},
+		{"/bin/false", false, true},
+	}
+	for i, c := range cases {
+		if got := s.IsLoginShell(c.shell); got != c.login {
+			t.Errorf("%d: IsLoginShell(%q): Got %v; Want %v", i, c.shell, got, c.login)
+		}
+		if got := s.IsNoLogin(c.shell); got != c.nologin {
+			t.Errorf("%d: IsNoLogin(%q): Got %v; Want %v", i, c.shell, got, c.nologin)
+		}
+	}
+}
+
+func TestNilShells(t *testing.T) {
+	var s *Shells
+	if !s.IsLoginShell("/bin/csh") || s.IsLoginShell("/bin/bash") {
+		t.Error("nil Shells does not use the getusershell defaults")
+	}
+}
+
+func TestInteractiveUsers(t *testing.T) {
+	s, _ := ParseShells(strings.NewReader(testShells))
+	pm, err := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/bash\n" +
+			"daemon:x:1:1::/:/usr/sbin/nologin\n" +
+			"sync:x:4:65534::/bin:/bin/sync\n" +
+			"maldridge:x:1000:1000::/home/maldridge:/usr/bin/zsh\n" +
+			"+::::::/bin/bash\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := pm.InteractiveUsers(s)
+	if len(got) != 2 || got[0].Login != "root" || got[1].Login != "maldridge" {
+		t.Errorf("Got %v", got)
+	}
+
+	pe := &PasswdEntry{Login: "maldridge", Shell: "/bin/sync"}
+	if err := pe.Validate(CheckShell(s.IsLoginShell)); err == nil {
+		t.Error("Validate accepted a shell that is not listed")
+	}
+}
+
+func TestUserShells(t *testing.T) {
+	db := newTestDB(t)
+	var err error
+	if db.Shells, err = ParseShells(strings.NewReader("/bin/sh\n/bin/bash\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.AddUser(NewUser{Login: "foo", Shell: "/bin/fish"}); !errors.Is(err, ErrInvalidShell) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidShell)
+	}
+	if _, err := db.AddUser(NewUser{Login: "foo", Shell: "/bin/bash"}); err != nil {
+		t.Error(err)
+	}
+	if _, err := db.AddUser(NewUser{Login: "daemon", Shell: "/usr/sbin/nologin", System: true}); err != nil {
+		t.Error(err)
+	}
+
+	shell := "/bin/fish"
+	if err := db.ModifyUser("foo", UserMod{Shell: &shell}); !errors.Is(err, ErrInvalidShell) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidShell)
+	}
+
+	// Only a shell that is being set is checked.
+	db.Passwd.LookupLogin("root").Shell = "/bin/sync"
+	comment := "Super User"
+	if err := db.ModifyUser("root", UserMod{Comment: &comment}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,211 @@
+package shadow
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A SubIDEntry is a single entry in the subuid or subgid database,
+// granting Owner the Count IDs beginning at Start.  The entry uses
+// the field names as found in `man 5 subuid`.  Owner may be either a
+// login name or a numeric UID.
+type SubIDEntry struct {
+	Owner string
+	Start int
+	Count int
+}
+
+// subIDFields names the fields of a SubIDEntry for errors.
+var subIDFields = []string{"owner", "start", "count"}
+
+func (se SubIDEntry) String() string {
+	return se.Owner + ":" +
+		strconv.Itoa(se.Start) + ":" +
+		strconv.Itoa(se.Count)
+}
+
+// Parse reads a single entry of the subuid or subgid database.
+func (se *SubIDEntry) Parse(s string) error {
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 {
+		return recordError(ErrWrongNumFields)
+	}
+
+	se.Owner = fields[0]
+
+	start, err := strconv.Atoi(fields[1])
+	if err != nil {
+		*se = SubIDEntry{}
+		return fieldError(subIDFields, 1, ErrNotANumber)
+	}
+	se.Start = start
+
+	count, err := strconv.Atoi(fields[2])
+	if err != nil {
+		*se = SubIDEntry{}
+		return fieldError(subIDFields, 2, ErrNotANumber)
+	}
+	se.Count = count
+
+	return nil
+}
+
+// Range returns the IDs covered by the entry.
+func (se SubIDEntry) Range() IDRange {
+	return IDRange{Min: se.Start, Max: se.Start + se.Count - 1}
+}
+
+// A SubIDMap is a complete subuid or subgid database.
+type SubIDMap struct {
+	lines []*SubIDEntry
+	raw   preserved
+}
+
+func (sm SubIDMap) String() string {
+	out := new(strings.Builder)
+	for _, l := range sm.lines {
+		sm.raw.write(out, l, l.String())
+	}
+	return sm.raw.end(out)
+}
+
+// WriteFile atomically replaces the subuid or subgid database at path
+// with the contents of the map.  The global and per-file locks are
+// held for the duration of the write.
+func (sm *SubIDMap) WriteFile(path string) error {
+	return writeLocked(path, []byte(sm.String()), 0644)
+}
+
+// ParseSubIDMap loads from the specified reader into a list of
+// SubIDEntry.
+func ParseSubIDMap(r io.Reader, opts ...ParseOption) (*SubIDMap, error) {
+	sm := &SubIDMap{lines: []*SubIDEntry{}}
+	opts = append([]ParseOption{plainText()}, opts...)
+	err := parseLines(r, opts, &sm.raw, func(s string) (fmt.Stringer, error) {
+		t := new(SubIDEntry)
+		if err := t.Parse(s); err != nil {
+			return nil, err
+		}
+		sm.lines = append(sm.lines, t)
+		return t, nil
+	})
+	if !keepMap(err) {
+		return nil, err
+	}
+	return sm, err
+}
+
+// FilterOwner applies a StringFilter to the Owner field of all loaded
+// SubIDEntry's and returns a list of all entries that matched.
+func (sm *SubIDMap) FilterOwner(f StringFilter) []*SubIDEntry {
+	nl := []*SubIDEntry{}
+	for _, l := range sm.lines {
+		if !f(l.Owner) {
+			// Filter did not match.
+			continue
+		}
+		nl = append(nl, l)
+	}
+	return nl
+}
+
+// Lookup returns all ranges granted to the user described by pe,
+// whether they name the user by login or by UID.
+func (sm *SubIDMap) Lookup(pe *PasswdEntry) []*SubIDEntry {
+	uid := strconv.Itoa(pe.UID)
+	return sm.FilterOwner(func(s string) bool { return s == pe.Login || s == uid })
+}
+
+// Add adds new entries to the existing map.  Neither uniqueness nor
+// the absence of overlaps is enforced.
+func (sm *SubIDMap) Add(a []*SubIDEntry) {
+	sm.lines = append(sm.lines, a...)
+}
+
+// Del removes entries that are exactly the same as any in the
+// provided list from the existing map.
+func (sm *SubIDMap) Del(d []*SubIDEntry) {
+	checkMap := make(map[SubIDEntry]bool, len(d))
+
+	for _, e := range d {
+		checkMap[*e] = true
+	}
+
+	out := []*SubIDEntry{}
+	for _, l := range sm.lines {
+		if checkMap[*l] {
+			// The entity is an exact match and should be
+			// removed.
+			sm.raw.drop(l)
+			continue
+		}
+		sm.raw.keep(l)
+		out = append(out, l)
+	}
+	sm.raw.flush()
+	sm.lines = out
+}
+
+// Ranges returns the IDs covered by every entry in the map, which is
+// suitable for use as Allocator.Reserved.
+func (sm *SubIDMap) Ranges() []IDRange {
+	out := []IDRange{}
+	for _, l := range sm.lines {
+		out = append(out, l.Range())
+	}
+	return out
+}
+
+// Overlaps returns every pair of entries whose ranges overlap.
+func (sm *SubIDMap) Overlaps() [][2]*SubIDEntry {
+	out := [][2]*SubIDEntry{}
+	for i, a := range sm.lines {
+		for _, b := range sm.lines[i+1:] {
+			if a.Range().Overlaps(b.Range()) {
+				out = append(out, [2]*SubIDEntry{a, b})
+			}
+		}
+	}
+	return out
+}
+
+// Allocate grants owner the lowest block of count IDs within r that
+// does not overlap any existing entry, in the same way as useradd(8)
+// does with SUB_UID_MIN, SUB_UID_MAX and SUB_UID_COUNT.  The new entry
+// is added to the map and returned.  ErrInvalidCount is returned if
+// count is not positive.
+func (sm *SubIDMap) Allocate(owner string, r IDRange, count int) (*SubIDEntry, error) {
+	start, err := sm.freeRange(r, count)
+	if err != nil {
+		return nil, err
+	}
+	se := &SubIDEntry{Owner: owner, Start: start, Count: count}
+	sm.Add([]*SubIDEntry{se})
+	return se, nil
+}
+
+// freeRange finds the start of the lowest block of count IDs within
+// r that is not in use.  The count must be positive.
+func (sm *SubIDMap) freeRange(r IDRange, count int) (int, error) {
+	if count <= 0 {
+		return 0, ErrInvalidCount
+	}
+	start := r.Min
+	for start+count-1 <= r.Max {
+		want := IDRange{Min: start, Max: start + count - 1}
+		clash := false
+		for _, l := range sm.lines {
+			if lr := l.Range(); lr.Overlaps(want) {
+				start = lr.Max + 1
+				clash = true
+				break
+			}
+		}
+		if !clash {
+			return start, nil
+		}
+	}
+	return 0, ErrNoFreeID
+}
@@ -0,0 +1,163 @@
+package shadow
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseSubIDEntry(t *testing.T) {
+	cases := []struct {
+		line      string
+		wantErr   error
+		wantEntry SubIDEntry
+	}{
+		{
+			line:    "",
+			wantErr: ErrWrongNumFields,
+		},
+		{
+			line:      "maldridge:100000:65536",
+			wantEntry: SubIDEntry{Owner: "maldridge", Start: 100000, Count: 65536},
+		},
+		{
+			line:    "maldridge:potato:65536",
+			wantErr: ErrNotANumber,
+		},
+	}
+
+	for i, c := range cases {
+		se := new(SubIDEntry)
+		if err := se.Parse(c.line); !errors.Is(err, c.wantErr) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+		if *se != c.wantEntry {
+			t.Errorf("%d: Got %v; Want %v", i, *se, c.wantEntry)
+		}
+		if c.wantErr == nil && se.String() != c.line {
+			t.Errorf("%d: Got '%s'; Want '%s'", i, se.String(), c.line)
+		}
+	}
+}
+
+func TestParseSubIDMap(t *testing.T) {
+	cases := []struct {
+		r       io.Reader
+		wantErr error
+	}{
+		{
+			r:       strings.NewReader("\nplaceholder\n"),
+			wantErr: ErrWrongNumFields,
+		},
+		{
+			r:       strings.NewReader("maldridge:100000:65536\n1001:165536:65536\n"),
+			wantErr: nil,
+		},
+	}
+	for i, c := range cases {
+		if _, err := ParseSubIDMap(c.r); !errors.Is(err, c.wantErr) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestSubIDLookup(t *testing.T) {
+	sm, _ := ParseSubIDMap(strings.NewReader(
+		"maldridge:100000:65536\n" +
+			"1000:300000:65536\n" +
+			"other:165536:65536\n"))
+
+	res := sm.Lookup(&PasswdEntry{Login: "maldridge", UID: 1000})
+	if len(res) != 2 || res[0].Start != 100000 || res[1].Start != 300000 {
+		t.Errorf("Bad lookup: %v", res)
+	}
+}
+
+func TestSubIDOverlaps(t *testing.T) {
+	sm, _ := ParseSubIDMap(strings.NewReader(
+		"a:100000:65536\n" +
+			"b:165536:65536\n" +
+			"c:200000:10\n"))
+
+	res := sm.Overlaps()
+	if len(res) != 1 || res[0][0].Owner != "b" || res[0][1].Owner != "c" {
+		t.Errorf("Bad overlaps: %v", res)
+	}
+}
+
+func TestSubIDAllocate(t *testing.T) {
+	sm, _ := ParseSubIDMap(strings.NewReader(
+		"a:100000:65536\n" +
+			"b:231072:65536\n"))
+
+	r := IDRange{Min: 100000, Max: 600100000}
+	se, err := sm.Allocate("c", r, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if se.Start != 165536 {
+		t.Errorf("Got %d; Want 165536", se.Start)
+	}
+	se, err = sm.Allocate("d", r, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if se.Start != 296608 {
+		t.Errorf("Got %d; Want 296608", se.Start)
+	}
+	if len(sm.Overlaps()) != 0 {
+		t.Error("Allocation overlaps")
+	}
+
+	if _, err := sm.Allocate("e", IDRange{Min: 100000, Max: 165535}, 65536); err != ErrNoFreeID {
+		t.Errorf("Got %v; Want %v", err, ErrNoFreeID)
+	}
+	for _, count := range []int{0, -1} {
+		if _, err := sm.Allocate("e", r, count); err != ErrInvalidCount {
+			t.Errorf("%d: Got %v; Want %v", count, err, ErrInvalidCount)
+		}
+	}
+	if len(sm.lines) != 4 {
+		t.Errorf("Got %d entries; Want 4", len(sm.lines))
+	}
+}
+
+func TestAddUserSubIDs(t *testing.T) {
+	db := newTestDB(t)
+	db.SubUID, _ = ParseSubIDMap(strings.NewReader("maldridge:100000:65536\n"))
+	db.SubGID, _ = ParseSubIDMap(strings.NewReader(""))
+
+	pe, err := db.AddUser(NewUser{Login: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := db.SubUID.Lookup(pe); len(res) != 1 || res[0].Start != 165536 {
+		t.Errorf("Bad subuid: %v", res)
+	}
+	if res := db.SubGID.Lookup(pe); len(res) != 1 || res[0].Start != 100000 {
+		t.Errorf("Bad subgid: %v", res)
+	}
+
+	if err := db.DeleteUser("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.SubUID.lines) != 1 || len(db.SubGID.lines) != 0 {
+		t.Error("Subordinate IDs not released")
+	}
+}
+
+func TestAddUserReservesSubIDs(t *testing.T) {
+	db := newTestDB(t)
+	db.SubUID, _ = ParseSubIDMap(strings.NewReader("other:1001:10\n"))
+	db.SubGID, _ = ParseSubIDMap(strings.NewReader(""))
+
+	// IDs in use as subordinate IDs are not given to users.
+	pe, err := db.AddUser(NewUser{Login: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.UID != 1011 || pe.GID != 1011 {
+		t.Errorf("Bad entry: %v", pe)
+	}
+}
@@ -0,0 +1,94 @@
+//go:build linux
+// +build linux
+
+package shadow
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+const selinuxXattr = "security.selinux"
+
+// fOFDSetlk is F_OFD_SETLK, which the syscall package does not
+// define.  Open file description locks conflict with the classic
+// fcntl locks taken by lckpwdf(3), but unlike those are not dropped
+// when some other descriptor for the same file is closed in this
+// process.
+const fOFDSetlk = 37
+
+// lockGlobal takes the fcntl lock on the global lock file in the same
+// way that lckpwdf(3) does, retrying until the timeout expires.
+func lockGlobal(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	lk := syscall.Flock_t{
+		Type:   syscall.F_WRLCK,
+		Whence: 0,
+		Start:  0,
+		Len:    0,
+	}
+	cmd := fOFDSetlk
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.FcntlFlock(f.Fd(), cmd, &lk)
+		if err == syscall.EINVAL && cmd == fOFDSetlk {
+			// Kernel is too old for OFD locks.
+			cmd = syscall.F_SETLK
+			continue
+		}
+		if err == nil {
+			return f, nil
+		}
+		if err != syscall.EAGAIN && err != syscall.EACCES {
+			f.Close()
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, ErrLocked
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// processAlive reports if pid refers to a running process.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// copyFileAttrs makes the file at dst carry the same owner, mode and
+// SELinux context as the file described by fi at src.
+func copyFileAttrs(dst string, src string, fi os.FileInfo) error {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if err := os.Chown(dst, int(st.Uid), int(st.Gid)); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(dst, fi.Mode().Perm()); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 256)
+	n, err := syscall.Getxattr(src, selinuxXattr, buf)
+	if err == syscall.ERANGE {
+		if n, err = syscall.Getxattr(src, selinuxXattr, nil); err == nil {
+			buf = make([]byte, n)
+			n, err = syscall.Getxattr(src, selinuxXattr, buf)
+		}
+	}
+	if err != nil {
+		// No label to copy, or labels not supported here.
+		return nil
+	}
+	err = syscall.Setxattr(dst, selinuxXattr, buf[:n], 0)
+	if err == syscall.ENOTSUP || err == syscall.EPERM {
+		return nil
+	}
+	return err
+}
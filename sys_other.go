@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package shadow
+
+import (
+	"os"
+	"time"
+)
+
+func lockGlobal(path string, timeout time.Duration) (*os.File, error) {
+	return nil, ErrLockUnsupported
+}
+
+func processAlive(pid int) bool {
+	return true
+}
+
+func copyFileAttrs(dst string, src string, fi os.FileInfo) error {
+	return os.Chmod(dst, fi.Mode().Perm())
+}
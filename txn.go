@@ -0,0 +1,388 @@
+package shadow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrTxnDone is returned when a transaction is used after it has
+// already been committed or rolled back.
+var ErrTxnDone = errors.New("transaction has already been committed or rolled back")
+
+// ErrInconsistent is returned when the account databases disagree
+// with each other in a way that would leave the system broken.
+var ErrInconsistent = errors.New("account databases are inconsistent")
+
+// A DB is the complete set of account databases for a system.
+// Passwd and Group must always be present.  The other databases may
+// be nil on systems which do not use them.
+type DB struct {
+	Passwd  *PasswdMap
+	Shadow  *ShadowMap
+	Group   *GroupMap
+	GShadow *GShadowMap
+
+	// SubUID and SubGID hold the subordinate ID databases, and
+	// are nil on systems that have none.
+	SubUID *SubIDMap
+	SubGID *SubIDMap
+
+	// LoginDefs supplies the defaults for new users.  If it is
+	// nil the shadow-utils defaults are used.
+	LoginDefs *LoginDefs
+
+	// Shells lists the valid login shells.  It is only read.  If
+	// it is set, AddUser and ModifyUser only accept shells that
+	// are listed, or that refuse logins.
+	Shells *Shells
+
+	// NameRules are the rules that AddUser, AddGroup, ModifyUser
+	// and ModifyGroup apply to the names they add, which default
+	// to those of shadow-utils.  Names already in the databases
+	// only have to be usable.
+	NameRules NameRules
+
+	// Allocator picks the IDs for new users and groups.  If it is
+	// nil one is built from the ranges in LoginDefs.
+	Allocator *Allocator
+}
+
+// Validate checks that the databases agree with each other.  Every
+// user must be present in both passwd and shadow, every group must
+// be present in both group and gshadow, and names must be unique.
+// The returned error wraps ErrInconsistent.  NIS compat entries are
+// not checked.
+func (db *DB) Validate() error {
+	logins := make(map[string]bool)
+	if db.Passwd != nil {
+		for _, l := range db.Passwd.lines {
+			if l.Compat() != CompatNone {
+				continue
+			}
+			if logins[l.Login] {
+				return fmt.Errorf("%w: duplicate user %s in passwd", ErrInconsistent, l.Login)
+			}
+			logins[l.Login] = true
+		}
+	}
+	if db.Shadow != nil {
+		seen := make(map[string]bool)
+		for _, l := range db.Shadow.lines {
+			if compatKind(l.Login) != CompatNone {
+				continue
+			}
+			if seen[l.Login] {
+				return fmt.Errorf("%w: duplicate user %s in shadow", ErrInconsistent, l.Login)
+			}
+			seen[l.Login] = true
+			if !logins[l.Login] {
+				return fmt.Errorf("%w: user %s in shadow but not in passwd", ErrInconsistent, l.Login)
+			}
+		}
+		if db.Passwd != nil {
+			for _, l := range db.Passwd.lines {
+				if l.Compat() == CompatNone && !seen[l.Login] {
+					return fmt.Errorf("%w: user %s in passwd but not in shadow", ErrInconsistent, l.Login)
+				}
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	if db.Group != nil {
+		for _, l := range db.Group.lines {
+			if l.Compat() != CompatNone {
+				continue
+			}
+			if names[l.Name] {
+				return fmt.Errorf("%w: duplicate group %s in group", ErrInconsistent, l.Name)
+			}
+			names[l.Name] = true
+		}
+	}
+	if db.GShadow != nil {
+		seen := make(map[string]bool)
+		for _, l := range db.GShadow.lines {
+			if compatKind(l.Name) != CompatNone {
+				continue
+			}
+			if seen[l.Name] {
+				return fmt.Errorf("%w: duplicate group %s in gshadow", ErrInconsistent, l.Name)
+			}
+			seen[l.Name] = true
+			if !names[l.Name] {
+				return fmt.Errorf("%w: group %s in gshadow but not in group", ErrInconsistent, l.Name)
+			}
+		}
+		if db.Group != nil {
+			for _, l := range db.Group.lines {
+				if l.Compat() == CompatNone && !seen[l.Name] {
+					return fmt.Errorf("%w: group %s in group but not in gshadow", ErrInconsistent, l.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// A Txn is a transaction over all account databases of a system.  It
+// holds the locks on all files from Begin until Commit or Rollback.
+// Changes are staged by modifying the maps in the embedded DB, and
+// are only written out by Commit.
+type Txn struct {
+	DB
+
+	root string
+	lock *Lock
+	orig map[string]string
+	done bool
+}
+
+// txnFile describes one of the databases handled by a transaction.
+type txnFile struct {
+	path string
+	perm os.FileMode
+	data fmt.Stringer
+}
+
+// Begin starts a transaction on the account databases found beneath
+// root, which is "/" for the running system.  All databases are
+// locked and loaded, along with login.defs if there is one.  A
+// missing passwd or group file is treated as empty, while any other
+// missing database leaves the corresponding map nil.
+func Begin(root string) (*Txn, error) {
+	t := &Txn{
+		root: root,
+		orig: make(map[string]string),
+	}
+
+	l, err := AcquireLock(t.path(PwdLockFile),
+		t.path(PasswdFile),
+		t.path(ShadowFile),
+		t.path(GroupFile),
+		t.path(GShadowFile),
+		t.path(SubUIDFile),
+		t.path(SubGIDFile),
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.lock = l
+
+	if err := t.load(); err != nil {
+		l.Release()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Txn) path(p string) string {
+	return filepath.Join(t.root, p)
+}
+
+func (t *Txn) load() error {
+	open := func(p string, parse func(io.Reader) error) error {
+		f, err := os.Open(t.path(p))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return parse(f)
+	}
+
+	err := open(PasswdFile, func(r io.Reader) (err error) {
+		t.Passwd, err = ParsePasswdMap(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if t.Passwd == nil {
+		t.Passwd = new(PasswdMap)
+	}
+
+	err = open(ShadowFile, func(r io.Reader) (err error) {
+		t.Shadow, err = ParseShadowMap(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = open(GroupFile, func(r io.Reader) (err error) {
+		t.Group, err = ParseGroupMap(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if t.Group == nil {
+		t.Group = new(GroupMap)
+	}
+
+	err = open(GShadowFile, func(r io.Reader) (err error) {
+		t.GShadow, err = ParseGShadowMap(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = open(SubUIDFile, func(r io.Reader) (err error) {
+		t.SubUID, err = ParseSubIDMap(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = open(SubGIDFile, func(r io.Reader) (err error) {
+		t.SubGID, err = ParseSubIDMap(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = open(LoginDefsFile, func(r io.Reader) (err error) {
+		t.LoginDefs, err = ParseLoginDefs(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = open(ShellsFile, func(r io.Reader) (err error) {
+		t.Shells, err = ParseShells(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range t.files() {
+		t.orig[f.path] = f.data.String()
+	}
+	return nil
+}
+
+// files returns the databases that are in use, in the order in which
+// they are committed.
+func (t *Txn) files() []txnFile {
+	out := []txnFile{}
+	if t.Passwd != nil {
+		out = append(out, txnFile{t.path(PasswdFile), 0644, t.Passwd})
+	}
+	if t.Shadow != nil {
+		out = append(out, txnFile{t.path(ShadowFile), 0640, t.Shadow})
+	}
+	if t.Group != nil {
+		out = append(out, txnFile{t.path(GroupFile), 0644, t.Group})
+	}
+	if t.GShadow != nil {
+		out = append(out, txnFile{t.path(GShadowFile), 0640, t.GShadow})
+	}
+	if t.SubUID != nil {
+		out = append(out, txnFile{t.path(SubUIDFile), 0644, t.SubUID})
+	}
+	if t.SubGID != nil {
+		out = append(out, txnFile{t.path(SubGIDFile), 0644, t.SubGID})
+	}
+	return out
+}
+
+// Commit validates the staged changes and writes every modified
+// database.  Either all files are replaced or none are: each file is
+// backed up and staged before any of them are renamed into place, and
+// if a rename fails the files already replaced are restored from
+// their backups.  The locks are released in all cases.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+	defer t.lock.Release()
+
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	type staged struct {
+		path    string
+		tmp     string
+		existed bool
+	}
+	pending := []staged{}
+	cleanup := func() {
+		for _, s := range pending {
+			os.Remove(s.tmp)
+		}
+	}
+
+	for _, f := range t.files() {
+		data := f.data.String()
+		if orig, ok := t.orig[f.path]; ok && orig == data {
+			// Unchanged, nothing to write.
+			continue
+		}
+		_, err := os.Stat(f.path)
+		existed := err == nil
+		if err := backupFile(f.path); err != nil {
+			cleanup()
+			return err
+		}
+		tmp, err := stageFile(f.path, []byte(data), f.perm)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		pending = append(pending, staged{f.path, tmp, existed})
+	}
+
+	for i, s := range pending {
+		if err := os.Rename(s.tmp, s.path); err != nil {
+			cleanup()
+			for _, done := range pending[:i] {
+				t.restore(done.path, done.existed)
+			}
+			return err
+		}
+	}
+	return syncDir(t.path(filepath.Dir(PasswdFile)))
+}
+
+// restore puts back the pre-transaction contents of path from its
+// backup, or removes it if it did not exist before.
+func (t *Txn) restore(path string, existed bool) {
+	if !existed {
+		os.Remove(path)
+		return
+	}
+	backup := path + "-"
+	data, err := ioutil.ReadFile(backup)
+	if err != nil {
+		return
+	}
+	tmp, err := stageFileAs(path, backup, data, 0)
+	if err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+// Rollback abandons the transaction without writing anything and
+// releases the locks.
+func (t *Txn) Rollback() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+	return t.lock.Release()
+}
@@ -0,0 +1,119 @@
+package shadow
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestRoot creates a system root with a minimal set of account
+// databases in it.
+func newTestRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		PasswdFile:  "root:x:0:0:root:/root:/bin/sh\n",
+		ShadowFile:  "root:*:17518:0:99999:7:::\n",
+		GroupFile:   "root:x:0:\n",
+		GShadowFile: "root:!::\n",
+	}
+	for p, c := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, p), []byte(c), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestTxnCommit(t *testing.T) {
+	root := newTestRoot(t)
+	defer os.RemoveAll(root)
+
+	txn, err := Begin(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(d time.Duration) { LockTimeout = d }(LockTimeout)
+	LockTimeout = 200 * time.Millisecond
+	if _, err := Begin(root); err != ErrLocked {
+		t.Errorf("Got %v; Want %v", err, ErrLocked)
+	}
+
+	txn.Passwd.Add([]*PasswdEntry{&PasswdEntry{Login: "foo", Password: "x", UID: 1000, GID: 1000}})
+	txn.Shadow.Add([]*ShadowEntry{&ShadowEntry{Login: "foo", Password: "!"}})
+	txn.Group.Add([]*GroupEntry{&GroupEntry{Name: "foo", Password: "x", GID: 1000}})
+	txn.GShadow.Add([]*GShadowEntry{&GShadowEntry{Name: "foo", Password: "!"}})
+
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(); err != ErrTxnDone {
+		t.Errorf("Got %v; Want %v", err, ErrTxnDone)
+	}
+
+	b, _ := ioutil.ReadFile(filepath.Join(root, PasswdFile))
+	want := "root:x:0:0:root:/root:/bin/sh\nfoo:x:1000:1000:::\n"
+	if string(b) != want {
+		t.Errorf("Got '%s'; Want '%s'", b, want)
+	}
+	b, _ = ioutil.ReadFile(filepath.Join(root, PasswdFile+"-"))
+	if string(b) != "root:x:0:0:root:/root:/bin/sh\n" {
+		t.Errorf("Bad backup '%s'", b)
+	}
+
+	// Locks must be gone after the commit.
+	txn, err = Begin(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Rollback()
+}
+
+func TestTxnInconsistent(t *testing.T) {
+	root := newTestRoot(t)
+	defer os.RemoveAll(root)
+
+	txn, err := Begin(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only passwd, no shadow entry.
+	txn.Passwd.Add([]*PasswdEntry{&PasswdEntry{Login: "foo", Password: "x", UID: 1000, GID: 1000}})
+	if err := txn.Commit(); !errors.Is(err, ErrInconsistent) {
+		t.Errorf("Got %v; Want %v", err, ErrInconsistent)
+	}
+
+	b, _ := ioutil.ReadFile(filepath.Join(root, PasswdFile))
+	if string(b) != "root:x:0:0:root:/root:/bin/sh\n" {
+		t.Errorf("Failed commit modified passwd: '%s'", b)
+	}
+}
+
+func TestTxnRollback(t *testing.T) {
+	root := newTestRoot(t)
+	defer os.RemoveAll(root)
+
+	txn, err := Begin(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Group.Add([]*GroupEntry{&GroupEntry{Name: "foo", Password: "x", GID: 1000}})
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(filepath.Join(root, GroupFile))
+	if string(b) != "root:x:0:\n" {
+		t.Errorf("Rollback modified group: '%s'", b)
+	}
+}
@@ -0,0 +1,524 @@
+package shadow
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// These are the defaults used when creating users, and match those
+// that useradd(8) uses when nothing else is configured.
+const (
+	defaultShell    = "/bin/sh"
+	defaultHomeBase = "/home"
+)
+
+// A NewUser describes a user to be created with AddUser.  Only Login
+// is required, everything else will be filled in with defaults in the
+// same way that useradd(8) would.
+type NewUser struct {
+	Login string
+
+	// Password is the already hashed password to store in the
+	// shadow database.  If it is empty the account is locked.
+	Password string
+
+	// UID is only used if HasUID is set, otherwise a free UID is
+	// allocated from the system or regular range depending on
+	// System.
+	UID    int
+	HasUID bool
+	System bool
+
+	Comment string
+	Home    string
+	Shell   string
+
+	// PrimaryGroup names an existing group to use as the primary
+	// group.  If it is empty a user private group with the same
+	// name as the login is created.
+	PrimaryGroup string
+
+	// Groups lists the supplementary groups the user should be
+	// a member of.  All of them must already exist.
+	Groups []string
+}
+
+// A UserMod describes changes to make to an existing user with
+// ModifyUser.  Fields left nil are not changed.
+type UserMod struct {
+	Login    *string
+	Password *string
+	UID      *int
+	Comment  *string
+	Home     *string
+	Shell    *string
+
+	// PrimaryGroup names the existing group to make the user's
+	// primary group.
+	PrimaryGroup *string
+
+	// Groups replaces the user's supplementary groups, unless
+	// AppendGroups is set in which case the user is added to
+	// these groups without leaving any.
+	Groups       *[]string
+	AppendGroups bool
+}
+
+// AddUser creates a new user in the same way as useradd(8).  The
+// passwd entry is created, along with a shadow entry carrying the
+// password aging values from login.defs, a user private group if no
+// primary group was requested, membership in any supplementary
+// groups, and subordinate ID ranges for regular users.  The new
+// passwd entry is returned.  Fields that cannot be written to the
+// databases are rejected with the error from Validate, as are logins
+// that NameRules does not allow.
+func (db *DB) AddUser(u NewUser) (*PasswdEntry, error) {
+	check := &PasswdEntry{Login: u.Login, Password: u.Password, UID: u.UID, Comment: u.Comment, Home: u.Home, Shell: u.Shell}
+	if err := check.Validate(db.validateOptions()...); err != nil {
+		return nil, err
+	}
+	if err := db.checkNewName(u.Login); err != nil {
+		return nil, err
+	}
+	if u.Shell != "" {
+		if err := db.checkShell(u.Shell); err != nil {
+			return nil, err
+		}
+	}
+	if db.Passwd.LookupLogin(u.Login) != nil {
+		return nil, ErrUserExists
+	}
+	if db.Shadow != nil && db.Shadow.LookupLogin(u.Login) != nil {
+		return nil, ErrUserExists
+	}
+
+	var primary *GroupEntry
+	if u.PrimaryGroup != "" {
+		if primary = db.Group.LookupName(u.PrimaryGroup); primary == nil {
+			return nil, ErrNoSuchGroup
+		}
+	} else {
+		if db.Group.LookupName(u.Login) != nil {
+			return nil, ErrGroupExists
+		}
+		if db.GShadow != nil && db.GShadow.find(u.Login) != nil {
+			return nil, ErrGroupExists
+		}
+	}
+	supplementary, err := db.groupsNamed(u.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	uid := u.UID
+	if u.HasUID {
+		if db.Passwd.LookupUID(uid) != nil {
+			return nil, ErrIDInUse
+		}
+	}
+
+	// As with useradd, regular users are given subordinate IDs on
+	// systems that use them.
+	type subid struct {
+		m *SubIDMap
+		e *SubIDEntry
+	}
+	subids := []subid{}
+	if !u.System {
+		want := []struct {
+			m     *SubIDMap
+			r     IDRange
+			count int
+		}{
+			{db.SubUID, db.LoginDefs.SubUIDRange(), db.LoginDefs.SubUIDCount()},
+			{db.SubGID, db.LoginDefs.SubGIDRange(), db.LoginDefs.SubGIDCount()},
+		}
+		for _, w := range want {
+			if w.m == nil || w.count <= 0 {
+				continue
+			}
+			start, err := w.m.freeRange(w.r, w.count)
+			if err != nil {
+				return nil, err
+			}
+			subids = append(subids, subid{w.m, &SubIDEntry{Owner: u.Login, Start: start, Count: w.count}})
+		}
+	}
+
+	if primary == nil {
+		// Prefer to give the user and their private group the
+		// same ID if at all possible.
+		gid := uid
+		switch {
+		case u.HasUID && db.Group.LookupGID(uid) == nil:
+		case u.HasUID:
+			gid, err = db.allocator().NextGID(db.Group, u.System)
+		default:
+			uid, err = db.allocator().NextUIDGID(db.Passwd, db.Group, u.System)
+			gid = uid
+			if err == ErrNoFreeID {
+				if uid, err = db.allocator().NextUID(db.Passwd, u.System); err == nil {
+					gid, err = db.allocator().NextGID(db.Group, u.System)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		primary = &GroupEntry{Name: u.Login, Password: "x", GID: gid}
+		db.Group.Add([]*GroupEntry{primary})
+		if db.GShadow != nil {
+			db.GShadow.Add([]*GShadowEntry{&GShadowEntry{Name: u.Login, Password: "!"}})
+		}
+	} else if !u.HasUID {
+		if uid, err = db.allocator().NextUID(db.Passwd, u.System); err != nil {
+			return nil, err
+		}
+	}
+
+	pe := &PasswdEntry{
+		Login:   u.Login,
+		UID:     uid,
+		GID:     primary.GID,
+		Comment: u.Comment,
+		Home:    u.Home,
+		Shell:   u.Shell,
+	}
+	if pe.Home == "" {
+		pe.Home = path.Join(defaultHomeBase, u.Login)
+	}
+	if pe.Shell == "" {
+		pe.Shell = defaultShell
+	}
+	password := u.Password
+	if password == "" {
+		password = "!"
+	}
+	if db.Shadow != nil {
+		pe.Password = "x"
+		db.Shadow.Add([]*ShadowEntry{db.LoginDefs.NewShadowEntry(u.Login, password, time.Now())})
+	} else {
+		pe.Password = password
+	}
+	db.Passwd.Add([]*PasswdEntry{pe})
+
+	for _, g := range supplementary {
+		db.addMember(g, u.Login)
+	}
+	for _, s := range subids {
+		s.m.Add([]*SubIDEntry{s.e})
+	}
+	return pe, nil
+}
+
+// ModifyUser changes an existing user in the same way as usermod(8).
+// Renaming a user also renames them in the shadow database and in
+// every group they are a member or administrator of.  As with
+// AddUser, the changed entry must pass Validate and a new login must
+// be allowed by NameRules.
+func (db *DB) ModifyUser(login string, m UserMod) error {
+	pe := db.Passwd.LookupLogin(login)
+	if pe == nil {
+		return ErrNoSuchUser
+	}
+
+	// Check everything that can fail before changing anything.
+	if m.Login != nil && *m.Login != login {
+		if db.Passwd.LookupLogin(*m.Login) != nil {
+			return ErrUserExists
+		}
+		if db.Shadow != nil && db.Shadow.LookupLogin(*m.Login) != nil {
+			return ErrUserExists
+		}
+	}
+	if m.UID != nil && *m.UID != pe.UID {
+		if db.Passwd.LookupUID(*m.UID) != nil {
+			return ErrIDInUse
+		}
+	}
+	var primary *GroupEntry
+	if m.PrimaryGroup != nil {
+		if primary = db.Group.LookupName(*m.PrimaryGroup); primary == nil {
+			return ErrNoSuchGroup
+		}
+	}
+	var groups []*GroupEntry
+	if m.Groups != nil {
+		var err error
+		if groups, err = db.groupsNamed(*m.Groups); err != nil {
+			return err
+		}
+	}
+
+	check := *pe
+	if m.Login != nil {
+		check.Login = *m.Login
+	}
+	if m.Password != nil {
+		check.Password = *m.Password
+	}
+	if m.UID != nil {
+		check.UID = *m.UID
+	}
+	if m.Comment != nil {
+		check.Comment = *m.Comment
+	}
+	if m.Home != nil {
+		check.Home = *m.Home
+	}
+	if m.Shell != nil {
+		check.Shell = *m.Shell
+	}
+	if err := check.Validate(db.validateOptions()...); err != nil {
+		return err
+	}
+	if m.Login != nil && *m.Login != login {
+		if err := db.checkNewName(*m.Login); err != nil {
+			return err
+		}
+	}
+	if m.Shell != nil && *m.Shell != "" {
+		if err := db.checkShell(*m.Shell); err != nil {
+			return err
+		}
+	}
+
+	var se *ShadowEntry
+	if db.Shadow != nil {
+		se = db.Shadow.LookupLogin(login)
+	}
+
+	if m.Login != nil && *m.Login != login {
+		db.renameMember(login, *m.Login)
+		pe.Login = *m.Login
+		db.Passwd.Reindex()
+		if se != nil {
+			se.Login = *m.Login
+			db.Shadow.Reindex()
+		}
+	}
+	if m.Password != nil {
+		if se != nil {
+			se.Password = *m.Password
+			se.LastChanged = dayOf(time.Now())
+			se.HasLastChanged = true
+		} else {
+			pe.Password = *m.Password
+		}
+	}
+	if m.UID != nil {
+		pe.UID = *m.UID
+		db.Passwd.Reindex()
+	}
+	if m.Comment != nil {
+		pe.Comment = *m.Comment
+	}
+	if m.Home != nil {
+		pe.Home = *m.Home
+	}
+	if m.Shell != nil {
+		pe.Shell = *m.Shell
+	}
+	if primary != nil {
+		pe.GID = primary.GID
+	}
+	if m.Groups != nil {
+		want := make(map[string]bool, len(groups))
+		for _, g := range groups {
+			want[g.Name] = true
+			db.addMember(g, pe.Login)
+		}
+		if !m.AppendGroups {
+			for _, g := range db.Group.lines {
+				if !want[g.Name] {
+					db.removeMember(g, pe.Login)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteUser removes a user in the same way as userdel(8).  The user
+// is removed from passwd and shadow, from the member and
+// administrator lists of every group, and their subordinate IDs are
+// released.  If the user's primary group is a user private group,
+// that is a group with the same name as the user which is not the
+// primary group of anyone else, it is removed as well.
+func (db *DB) DeleteUser(login string) error {
+	return db.deleteUser(login, true)
+}
+
+// deleteUser removes a user, along with their user private group if
+// upg is set.
+func (db *DB) deleteUser(login string, upg bool) error {
+	pe := db.Passwd.LookupLogin(login)
+	if pe == nil {
+		return ErrNoSuchUser
+	}
+
+	db.Passwd.Del([]*PasswdEntry{pe})
+	if db.Shadow != nil {
+		if se := db.Shadow.LookupLogin(login); se != nil {
+			db.Shadow.Del([]*ShadowEntry{se})
+		}
+	}
+	for _, g := range db.Group.lines {
+		db.removeMember(g, login)
+	}
+	if db.GShadow != nil {
+		for _, g := range db.GShadow.lines {
+			g.Administrators = without(g.Administrators, login)
+		}
+	}
+	if db.SubUID != nil {
+		db.SubUID.Del(db.SubUID.Lookup(pe))
+	}
+	if db.SubGID != nil {
+		db.SubGID.Del(db.SubGID.Lookup(pe))
+	}
+
+	if !upg {
+		return nil
+	}
+	ge := db.Group.LookupName(login)
+	if ge == nil || ge.GID != pe.GID {
+		return nil
+	}
+	for _, l := range db.Passwd.lines {
+		if l.Compat() == CompatNone && l.GID == ge.GID {
+			// Still in use as someone's primary group.
+			return nil
+		}
+	}
+	db.Group.Del([]*GroupEntry{ge})
+	if db.GShadow != nil {
+		if gse := db.GShadow.find(login); gse != nil {
+			db.GShadow.Del([]*GShadowEntry{gse})
+		}
+	}
+	return nil
+}
+
+// groupsNamed resolves a list of group names, failing if any of them
+// do not exist.
+func (db *DB) groupsNamed(names []string) ([]*GroupEntry, error) {
+	out := []*GroupEntry{}
+	for _, n := range names {
+		g := db.Group.LookupName(n)
+		if g == nil {
+			return nil, ErrNoSuchGroup
+		}
+		out = append(out, g)
+	}
+	return out, nil
+}
+
+// addMember adds login to the members of g, keeping gshadow in step.
+func (db *DB) addMember(g *GroupEntry, login string) {
+	if !contains(g.UserList, login) {
+		g.UserList = append(g.UserList, login)
+	}
+	if db.GShadow == nil {
+		return
+	}
+	if gse := db.GShadow.find(g.Name); gse != nil && !contains(gse.Members, login) {
+		gse.Members = append(gse.Members, login)
+	}
+}
+
+// removeMember removes login from the members of g, keeping gshadow
+// in step.
+func (db *DB) removeMember(g *GroupEntry, login string) {
+	g.UserList = without(g.UserList, login)
+	if db.GShadow == nil {
+		return
+	}
+	if gse := db.GShadow.find(g.Name); gse != nil {
+		gse.Members = without(gse.Members, login)
+	}
+}
+
+// renameMember replaces from with to in every group member and
+// administrator list.
+func (db *DB) renameMember(from, to string) {
+	rename := func(list []string) {
+		for i := range list {
+			if list[i] == from {
+				list[i] = to
+			}
+		}
+	}
+	for _, g := range db.Group.lines {
+		rename(g.UserList)
+	}
+	if db.GShadow != nil {
+		for _, g := range db.GShadow.lines {
+			rename(g.Administrators)
+			rename(g.Members)
+		}
+	}
+}
+
+// validateOptions returns the options that entries are validated
+// with before they are added or changed.  Names only have to be
+// usable, as with the --badname option of useradd(8), because the
+// databases may already hold names that stricter rules reject.  New
+// names are checked by checkNewName as well.
+func (db *DB) validateOptions() []ValidateOption {
+	return []ValidateOption{WithNameRules(NameRulesRelaxed)}
+}
+
+// checkNewName checks a user or group name that is being added to
+// the databases against NameRules.
+func (db *DB) checkNewName(name string) error {
+	return newValidateOptions([]ValidateOption{WithNameRules(db.NameRules)}).checkName(name)
+}
+
+// checkShell checks that shell may be given to a user, which is the
+// case if it is listed in Shells or refuses logins, as nologin(8) is
+// often not listed.  Any shell is allowed if Shells is nil.
+func (db *DB) checkShell(shell string) error {
+	if db.Shells == nil || db.Shells.Contains(shell) || db.Shells.IsNoLogin(shell) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q is not a valid login shell", ErrInvalidShell, shell)
+}
+
+// allocator returns the Allocator to use for new IDs.  Unless one
+// was set, the ranges come from login.defs and the subordinate IDs
+// already handed out are reserved.
+func (db *DB) allocator() *Allocator {
+	if db.Allocator != nil {
+		return db.Allocator
+	}
+	a := db.LoginDefs.Allocator()
+	if db.SubUID != nil {
+		a.Reserved = append(a.Reserved, db.SubUID.Ranges()...)
+	}
+	if db.SubGID != nil {
+		a.Reserved = append(a.Reserved, db.SubGID.Ranges()...)
+	}
+	return a
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns list with every occurrence of s removed.
+func without(list []string, s string) []string {
+	out := []string{}
+	for _, l := range list {
+		if l != s {
+			out = append(out, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,225 @@
+package shadow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestDB(t *testing.T) *DB {
+	pm, err := ParsePasswdMap(strings.NewReader(
+		"root:x:0:0:root:/root:/bin/sh\n" +
+			"maldridge:x:1000:1000::/home/maldridge:/bin/bash\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := ParseShadowMap(strings.NewReader(
+		"root:*:17518:0:99999:7:::\n" +
+			"maldridge:!:17518:0:99999:7:::\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gm, err := ParseGroupMap(strings.NewReader(
+		"root:x:0:\n" +
+			"wheel:x:10:maldridge\n" +
+			"maldridge:x:1000:\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gsm, err := ParseGShadowMap(strings.NewReader(
+		"root:!::\n" +
+			"wheel:!:maldridge:maldridge\n" +
+			"maldridge:!::\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := ParseLoginDefs(strings.NewReader(
+		"PASS_MAX_DAYS\t99999\n" +
+			"PASS_MIN_DAYS\t0\n" +
+			"PASS_WARN_AGE\t7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DB{Passwd: pm, Shadow: sm, Group: gm, GShadow: gsm, LoginDefs: ld}
+}
+
+func TestAddUser(t *testing.T) {
+	db := newTestDB(t)
+
+	pe, err := db.AddUser(NewUser{Login: "foo", Groups: []string{"wheel"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe.UID != 1001 || pe.GID != 1001 || pe.Home != "/home/foo" || pe.Password != "x" {
+		t.Errorf("Bad entry: %v", pe)
+	}
+	se := db.Shadow.LookupLogin("foo")
+	if se == nil || se.Password != "!" || se.MaximumPasswordAge != 99999 || !se.HasLastChanged {
+		t.Errorf("Bad shadow entry: %v", se)
+	}
+	if g := db.Group.LookupName("foo"); g == nil || g.GID != 1001 {
+		t.Errorf("Bad private group: %v", g)
+	}
+	if db.GShadow.find("foo") == nil {
+		t.Error("Private group missing from gshadow")
+	}
+	if g := db.Group.LookupName("wheel"); !contains(g.UserList, "foo") {
+		t.Errorf("Not added to wheel: %v", g)
+	}
+	if err := db.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := db.AddUser(NewUser{Login: "foo"}); err != ErrUserExists {
+		t.Errorf("Got %v; Want %v", err, ErrUserExists)
+	}
+	if _, err := db.AddUser(NewUser{Login: "bar", Groups: []string{"nope"}}); err != ErrNoSuchGroup {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchGroup)
+	}
+	if _, err := db.AddUser(NewUser{Login: "bar", UID: 1000, HasUID: true}); err != ErrIDInUse {
+		t.Errorf("Got %v; Want %v", err, ErrIDInUse)
+	}
+
+	sys, err := db.AddUser(NewUser{Login: "daemon", System: true, PrimaryGroup: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys.UID != 999 || sys.GID != 0 {
+		t.Errorf("Bad system user: %v", sys)
+	}
+}
+
+func TestAddUserInvalid(t *testing.T) {
+	db := newTestDB(t)
+	cases := []struct {
+		u    NewUser
+		want error
+	}{
+		{NewUser{Login: "foo", Comment: "a:b"}, ErrInvalidCharacter},
+		{NewUser{Login: "foo", Password: "x:0:0:99999:7:::\nroot2:"}, ErrInvalidCharacter},
+		{NewUser{Login: "foo", Home: "home/foo"}, ErrInvalidHome},
+		{NewUser{Login: "foo", Shell: "/bin/sh\n"}, ErrInvalidCharacter},
+		{NewUser{Login: "foo,bar"}, ErrInvalidName},
+	}
+
+	for i, c := range cases {
+		if _, err := db.AddUser(c.u); !errors.Is(err, c.want) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.want)
+		}
+	}
+	if len(db.Passwd.lines) != 2 || len(db.Group.lines) != 3 {
+		t.Error("Invalid user was added")
+	}
+
+	// New names follow NameRules.
+	if _, err := db.AddUser(NewUser{Login: "Debian-exim"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidName)
+	}
+	db.NameRules = NameRulesRelaxed
+	if _, err := db.AddUser(NewUser{Login: "Debian-exim"}); err != nil {
+		t.Error(err)
+	}
+
+	// Existing names only have to be usable.
+	db.NameRules = NameRulesShadow
+	shell := "/bin/zsh"
+	if err := db.ModifyUser("Debian-exim", UserMod{Shell: &shell}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestModifyUserInvalid(t *testing.T) {
+	db := newTestDB(t)
+	shell := "/bin/sh\nroot2::0:0::/:/bin/sh"
+	if err := db.ModifyUser("maldridge", UserMod{Shell: &shell}); !errors.Is(err, ErrInvalidCharacter) {
+		t.Errorf("Got %v; Want %v", err, ErrInvalidCharacter)
+	}
+	if pe := db.Passwd.LookupLogin("maldridge"); pe.Shell != "/bin/bash" {
+		t.Errorf("Invalid change applied: %v", pe)
+	}
+}
+
+func TestModifyUser(t *testing.T) {
+	db := newTestDB(t)
+
+	name := "mal"
+	shell := "/bin/zsh"
+	groups := []string{"root"}
+	err := db.ModifyUser("maldridge", UserMod{
+		Login:  &name,
+		Shell:  &shell,
+		Groups: &groups,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pe := db.Passwd.LookupLogin("mal")
+	if pe == nil || pe.Shell != "/bin/zsh" {
+		t.Errorf("Bad entry: %v", pe)
+	}
+	if db.Shadow.LookupLogin("mal") == nil {
+		t.Error("Shadow entry not renamed")
+	}
+	if g := db.Group.LookupName("wheel"); len(g.UserList) != 0 {
+		t.Errorf("Not removed from wheel: %v", g)
+	}
+	if g := db.Group.LookupName("root"); !contains(g.UserList, "mal") {
+		t.Errorf("Not added to root: %v", g)
+	}
+	if gse := db.GShadow.find("wheel"); !contains(gse.Administrators, "mal") {
+		t.Errorf("Administrator not renamed: %v", gse)
+	}
+
+	if err := db.ModifyUser("nobody", UserMod{}); err != ErrNoSuchUser {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchUser)
+	}
+	root := "root"
+	if err := db.ModifyUser("mal", UserMod{Login: &root}); err != ErrUserExists {
+		t.Errorf("Got %v; Want %v", err, ErrUserExists)
+	}
+
+	// An orphaned shadow entry also blocks the rename.
+	orphan := "orphan"
+	db.Shadow.Add([]*ShadowEntry{&ShadowEntry{Login: orphan, Password: "!"}})
+	if err := db.ModifyUser("mal", UserMod{Login: &orphan}); err != ErrUserExists {
+		t.Errorf("Got %v; Want %v", err, ErrUserExists)
+	}
+	if db.Passwd.LookupLogin("mal") == nil {
+		t.Error("Failed rename changed the user")
+	}
+
+	// As does an orphaned gshadow entry for the private group of
+	// a new user.
+	db.GShadow.Add([]*GShadowEntry{&GShadowEntry{Name: "foo", Password: "!"}})
+	if _, err := db.AddUser(NewUser{Login: "foo"}); err != ErrGroupExists {
+		t.Errorf("Got %v; Want %v", err, ErrGroupExists)
+	}
+	if db.Passwd.LookupLogin("foo") != nil {
+		t.Error("User added despite the gshadow entry")
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := db.DeleteUser("maldridge"); err != nil {
+		t.Fatal(err)
+	}
+	if db.Passwd.LookupLogin("maldridge") != nil || db.Shadow.LookupLogin("maldridge") != nil {
+		t.Error("User not removed")
+	}
+	if db.Group.LookupName("maldridge") != nil || db.GShadow.find("maldridge") != nil {
+		t.Error("Private group not removed")
+	}
+	gse := db.GShadow.find("wheel")
+	if len(gse.Administrators) != 0 || len(gse.Members) != 0 {
+		t.Errorf("Not removed from gshadow: %v", gse)
+	}
+	if err := db.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := db.DeleteUser("maldridge"); err != ErrNoSuchUser {
+		t.Errorf("Got %v; Want %v", err, ErrNoSuchUser)
+	}
+}
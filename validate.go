@@ -0,0 +1,229 @@
+package shadow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NameRules selects the rules that Validate applies to user and
+// group names.
+type NameRules int
+
+// NameRulesShadow is the default of shadow-utils, which only allows
+// names matching [a-z_][a-z0-9_-]*[$]? of up to 32 characters.
+// NameRulesRelaxed is what shadow-utils accepts with --badname, which
+// only rejects names that cannot work at all.  NameRulesSystemd is
+// the strict mode of systemd, which also allows upper case letters
+// but not a trailing "$", and limits names to 31 characters.
+const (
+	NameRulesShadow NameRules = iota
+	NameRulesRelaxed
+	NameRulesSystemd
+)
+
+// nameMaxLength is the longest name shadow-utils accepts, which is
+// the size of a name in utmp.
+const nameMaxLength = 32
+
+// A ValidateOption changes the checks made by Validate.
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	rules NameRules
+	shell StringFilter
+}
+
+func newValidateOptions(opts []ValidateOption) *validateOptions {
+	o := new(validateOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithNameRules validates names with r instead of NameRulesShadow.
+func WithNameRules(r NameRules) ValidateOption {
+	return func(o *validateOptions) { o.rules = r }
+}
+
+// CheckShell additionally requires shells to be accepted by f, for
+// example Shells.Contains to allow only the shells listed in
+// /etc/shells.  Empty shells, which mean /bin/sh, are not checked.
+func CheckShell(f StringFilter) ValidateOption {
+	return func(o *validateOptions) { o.shell = f }
+}
+
+// Validate checks that the entry can be written to the passwd
+// database and used by shadow-utils.  The login must follow the name
+// rules, no field may contain a colon or a control character, the
+// UID and GID must not be negative, and the home directory and shell
+// must be absolute paths if set.  Only the fields of compat entries
+// are checked, as their names are not user names.
+func (pe *PasswdEntry) Validate(opts ...ValidateOption) error {
+	o := newValidateOptions(opts)
+
+	values := []string{pe.Login, pe.Password, "", "", pe.Comment, pe.Home, pe.Shell}
+	if err := checkFields(passwdFields, values, ":"); err != nil {
+		return err
+	}
+	if pe.Compat() == CompatNone {
+		if err := o.checkName(pe.Login); err != nil {
+			return err
+		}
+	}
+	if pe.UID < 0 {
+		return fmt.Errorf("%w: uid %d", ErrNegativeValue, pe.UID)
+	}
+	if pe.GID < 0 {
+		return fmt.Errorf("%w: gid %d", ErrNegativeValue, pe.GID)
+	}
+	if pe.Home != "" && !strings.HasPrefix(pe.Home, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalidHome, pe.Home)
+	}
+	if pe.Shell != "" {
+		if !strings.HasPrefix(pe.Shell, "/") || o.shell != nil && !o.shell(pe.Shell) {
+			return fmt.Errorf("%w: %q", ErrInvalidShell, pe.Shell)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the entry can be written to the shadow
+// database.  The login must follow the name rules, the login,
+// password and reserved field must not contain a colon or a control
+// character, and the aging fields that are set must not be negative.
+func (se *ShadowEntry) Validate(opts ...ValidateOption) error {
+	o := newValidateOptions(opts)
+
+	values := []string{se.Login, se.Password, "", "", "", "", "", "", se.Reserved}
+	if err := checkFields(shadowFields, values, ":"); err != nil {
+		return err
+	}
+	if compatKind(se.Login) == CompatNone {
+		if err := o.checkName(se.Login); err != nil {
+			return err
+		}
+	}
+
+	numbers := []int{
+		2: dayField(se.LastChanged, se.HasLastChanged),
+		3: intField(se.MinimumPasswordAge, se.HasMinimumPasswordAge),
+		4: intField(se.MaximumPasswordAge, se.HasMaximumPasswordAge),
+		5: intField(se.WarningDays, se.HasWarningDays),
+		6: intField(se.InactivityDays, se.HasInactivityDays),
+		7: dayField(se.Expiration, se.HasExpiration),
+	}
+	set := []bool{
+		2: se.HasLastChanged,
+		3: se.HasMinimumPasswordAge,
+		4: se.HasMaximumPasswordAge,
+		5: se.HasWarningDays,
+		6: se.HasInactivityDays,
+		7: se.HasExpiration,
+	}
+	for i := 2; i < len(numbers); i++ {
+		if set[i] && numbers[i] < 0 {
+			return fmt.Errorf("%w: %s", ErrNegativeValue, shadowFields[i])
+		}
+	}
+	return nil
+}
+
+// Validate checks that the entry can be written to the group
+// database.  The name and every member must follow the name rules,
+// no field may contain a colon or a control character, members may
+// not contain a comma, and the GID must not be negative.  Only the
+// fields of compat entries are checked.
+func (ge *GroupEntry) Validate(opts ...ValidateOption) error {
+	o := newValidateOptions(opts)
+
+	if err := checkFields(groupFields, []string{ge.Name, ge.Password}, ":"); err != nil {
+		return err
+	}
+	for _, m := range ge.UserList {
+		if err := checkFields(groupFields[3:], []string{m}, ":,"); err != nil {
+			return err
+		}
+	}
+	if ge.Compat() == CompatNone {
+		if err := o.checkName(ge.Name); err != nil {
+			return err
+		}
+		for _, m := range ge.UserList {
+			if err := o.checkName(m); err != nil {
+				return err
+			}
+		}
+	}
+	if ge.GID < 0 {
+		return fmt.Errorf("%w: gid %d", ErrNegativeValue, ge.GID)
+	}
+	return nil
+}
+
+// checkFields checks that none of values, which are named by the
+// matching entry of names, contain a control character or any of
+// separators.
+func checkFields(names, values []string, separators string) error {
+	for i, v := range values {
+		for _, c := range v {
+			if c < ' ' || c == 0x7f || strings.ContainsRune(separators, c) {
+				return fmt.Errorf("%w: %q in %s", ErrInvalidCharacter, c, names[i])
+			}
+		}
+	}
+	return nil
+}
+
+// checkName checks a user or group name against the name rules.
+func (o *validateOptions) checkName(name string) error {
+	if !validName(name, o.rules) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// validName reports if name is allowed by rules.  Names that could
+// be mistaken for an option, a path or a numeric ID are never
+// allowed, as in shadow-utils.
+func validName(name string, rules NameRules) bool {
+	if name == "" || name == "." || name == ".." ||
+		strings.HasPrefix(name, "-") ||
+		strings.ContainsAny(name, " \"#',/:;") ||
+		strings.Trim(name, "0123456789") == "" {
+		return false
+	}
+
+	lower := func(c rune) bool { return c >= 'a' && c <= 'z' }
+	upper := func(c rune) bool { return c >= 'A' && c <= 'Z' }
+	digit := func(c rune) bool { return c >= '0' && c <= '9' }
+
+	switch rules {
+	case NameRulesRelaxed:
+		return len(name) <= nameMaxLength
+	case NameRulesSystemd:
+		if len(name) > nameMaxLength-1 {
+			return false
+		}
+		for i, c := range name {
+			if !(lower(c) || upper(c) || c == '_' || i > 0 && (digit(c) || c == '-')) {
+				return false
+			}
+		}
+		return true
+	default:
+		if len(name) > nameMaxLength {
+			return false
+		}
+		for i, c := range name {
+			if lower(c) || c == '_' || i > 0 && (digit(c) || c == '-') {
+				continue
+			}
+			if i > 0 && c == '$' && i == len(name)-1 {
+				continue
+			}
+			return false
+		}
+		return true
+	}
+}
@@ -0,0 +1,110 @@
+package shadow
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidName(t *testing.T) {
+	cases := []struct {
+		name  string
+		rules NameRules
+		want  bool
+	}{
+		{"maldridge", NameRulesShadow, true},
+		{"_apt", NameRulesShadow, true},
+		{"build-01", NameRulesShadow, true},
+		{"host$", NameRulesShadow, true},
+		{"ho$st", NameRulesShadow, false},
+		{"Maldridge", NameRulesShadow, false},
+		{"1user", NameRulesShadow, false},
+		{"user name", NameRulesShadow, false},
+		{"abcdefghijklmnopqrstuvwxyzabcdef", NameRulesShadow, true},
+		{"abcdefghijklmnopqrstuvwxyzabcdefg", NameRulesShadow, false},
+		{"Maldridge", NameRulesRelaxed, true},
+		{"1user", NameRulesRelaxed, true},
+		{"user.name", NameRulesRelaxed, true},
+		{"1000", NameRulesRelaxed, false},
+		{"-user", NameRulesRelaxed, false},
+		{"..", NameRulesRelaxed, false},
+		{"user name", NameRulesRelaxed, false},
+		{"", NameRulesRelaxed, false},
+		{"Maldridge", NameRulesSystemd, true},
+		{"host$", NameRulesSystemd, false},
+		{"abcdefghijklmnopqrstuvwxyzabcdef", NameRulesSystemd, false},
+	}
+
+	for i, c := range cases {
+		if got := validName(c.name, c.rules); got != c.want {
+			t.Errorf("%d: %q: Got %v; Want %v", i, c.name, got, c.want)
+		}
+	}
+}
+
+func TestPasswdValidate(t *testing.T) {
+	shells := CheckShell(EqualsString("/bin/sh").Or(EqualsString("/bin/zsh")))
+	cases := []struct {
+		pe      PasswdEntry
+		opts    []ValidateOption
+		wantErr error
+	}{
+		{PasswdEntry{Login: "maldridge", Password: "x", UID: 1000, GID: 1000, Home: "/home/maldridge", Shell: "/bin/sh"}, nil, nil},
+		{PasswdEntry{Login: "mal dridge"}, nil, ErrInvalidName},
+		{PasswdEntry{Login: "Maldridge"}, []ValidateOption{WithNameRules(NameRulesSystemd)}, nil},
+		{PasswdEntry{Login: "maldridge", Home: "/home/a:b"}, nil, ErrInvalidCharacter},
+		{PasswdEntry{Login: "maldridge", Comment: "line\nbreak"}, nil, ErrInvalidCharacter},
+		{PasswdEntry{Login: "maldridge", Home: "home"}, nil, ErrInvalidHome},
+		{PasswdEntry{Login: "maldridge", Shell: "sh"}, nil, ErrInvalidShell},
+		{PasswdEntry{Login: "maldridge", Shell: "/bin/fish"}, nil, nil},
+		{PasswdEntry{Login: "maldridge", Shell: "/bin/fish"}, []ValidateOption{shells}, ErrInvalidShell},
+		{PasswdEntry{Login: "maldridge"}, []ValidateOption{shells}, nil},
+		{PasswdEntry{Login: "maldridge", UID: -1}, nil, ErrNegativeValue},
+		{PasswdEntry{Login: "+@Admins"}, nil, nil},
+	}
+
+	for i, c := range cases {
+		if err := c.pe.Validate(c.opts...); !errors.Is(err, c.wantErr) || (err == nil) != (c.wantErr == nil) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestShadowValidate(t *testing.T) {
+	cases := []struct {
+		se      ShadowEntry
+		wantErr error
+	}{
+		{ShadowEntry{Login: "maldridge", Password: "!", LastChanged: epochStart, HasLastChanged: true}, nil},
+		{ShadowEntry{Login: "maldridge", Password: "a:b"}, ErrInvalidCharacter},
+		{ShadowEntry{Login: "maldridge", Reserved: "x\nroot2::0"}, ErrInvalidCharacter},
+		{ShadowEntry{Login: "Maldridge"}, ErrInvalidName},
+		{ShadowEntry{Login: "maldridge", MaximumPasswordAge: -1, HasMaximumPasswordAge: true}, ErrNegativeValue},
+		{ShadowEntry{Login: "maldridge", MaximumPasswordAge: -1}, nil},
+	}
+
+	for i, c := range cases {
+		if err := c.se.Validate(); !errors.Is(err, c.wantErr) || (err == nil) != (c.wantErr == nil) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
+
+func TestGroupValidate(t *testing.T) {
+	cases := []struct {
+		ge      GroupEntry
+		wantErr error
+	}{
+		{GroupEntry{Name: "wheel", Password: "x", GID: 10, UserList: []string{"maldridge"}}, nil},
+		{GroupEntry{Name: "wheel", UserList: []string{"a,b"}}, ErrInvalidCharacter},
+		{GroupEntry{Name: "wheel", UserList: []string{"Root"}}, ErrInvalidName},
+		{GroupEntry{Name: "whe:el"}, ErrInvalidCharacter},
+		{GroupEntry{Name: "wheel", GID: -5}, ErrNegativeValue},
+		{GroupEntry{Name: "+"}, nil},
+	}
+
+	for i, c := range cases {
+		if err := c.ge.Validate(); !errors.Is(err, c.wantErr) || (err == nil) != (c.wantErr == nil) {
+			t.Errorf("%d: Got %v; Want %v", i, err, c.wantErr)
+		}
+	}
+}
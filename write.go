@@ -0,0 +1,129 @@
+package shadow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile atomically replaces the file at path with data.  The new
+// contents are written to a temporary file beside path, synced to
+// disk and then renamed into place so that readers see either the old
+// or the new file, never a partial one.  If path already exists its
+// owner, mode and SELinux context are carried over and its previous
+// contents are kept in a backup named with a trailing '-', as in
+// /etc/passwd-.  If path does not exist it is created with perm.
+//
+// WriteFile does not take any locks, see the WriteFile method on each
+// map for a version which does.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if err := backupFile(path); err != nil {
+		return err
+	}
+	tmp, err := stageFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// writeLocked writes data to path while holding both the global lock
+// and the per-file lock for path.
+func writeLocked(path string, data []byte, perm os.FileMode) error {
+	l, err := AcquireLock(lockPathFor(path), path)
+	if err != nil {
+		return err
+	}
+	if err := WriteFile(path, data, perm); err != nil {
+		l.Release()
+		return err
+	}
+	return l.Release()
+}
+
+// stageFile writes data into a temporary file next to path and
+// returns the name of the temporary file.  The temporary file has
+// the attributes of path if it exists, or perm if it does not.
+func stageFile(path string, data []byte, perm os.FileMode) (string, error) {
+	return stageFileAs(path, path, data, perm)
+}
+
+// stageFileAs is stageFile, but copies the file attributes from
+// attrSrc rather than the file being replaced.
+func stageFileAs(path, attrSrc string, data []byte, perm os.FileMode) (string, error) {
+	tmp := path + "+"
+	os.Remove(tmp)
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	fail := func(err error) (string, error) {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		return fail(err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	fi, err := os.Stat(attrSrc)
+	switch {
+	case err == nil:
+		err = copyFileAttrs(tmp, attrSrc, fi)
+	case os.IsNotExist(err):
+		err = os.Chmod(tmp, perm)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// backupFile copies the current contents of path to the backup file
+// path-.  Nothing is done if path does not exist.
+func backupFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backup := path + "-"
+	tmp, err := stageFileAs(backup, path, data, 0)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, backup); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// syncDir flushes directory metadata so that a completed rename
+// survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
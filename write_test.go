@@ -0,0 +1,127 @@
+package shadow
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "passwd")
+	if err := WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + "-"); !os.IsNotExist(err) {
+		t.Error("Backup created for a file that didn't exist")
+	}
+	if err := os.Chmod(path, 0604); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	if string(b) != "new\n" {
+		t.Errorf("Got '%s'; Want 'new\\n'", b)
+	}
+	b, _ = ioutil.ReadFile(path + "-")
+	if string(b) != "old\n" {
+		t.Errorf("Got backup '%s'; Want 'old\\n'", b)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0604 {
+		t.Errorf("Mode not preserved: %v", fi.Mode())
+	}
+	if _, err := os.Stat(path + "+"); !os.IsNotExist(err) {
+		t.Error("Temporary file left behind")
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pwdLock := filepath.Join(dir, ".pwd.lock")
+	passwd := filepath.Join(dir, "passwd")
+
+	l, err := AcquireLock(pwdLock, passwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(passwd + ".lock"); err != nil {
+		t.Error("Per-file lock not created")
+	}
+	if err := lockFile(passwd); err != ErrLocked {
+		t.Errorf("Got %v; Want %v", err, ErrLocked)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(passwd + ".lock"); !os.IsNotExist(err) {
+		t.Error("Per-file lock not removed")
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwd := filepath.Join(dir, "passwd")
+
+	// No process will ever have this pid on Linux.
+	if err := ioutil.WriteFile(passwd+".lock", []byte("2147483647"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockFile(passwd); err != nil {
+		t.Errorf("Stale lock not broken: %v", err)
+	}
+}
+
+func TestMapWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gm := &GroupMap{
+		lines: []*GroupEntry{
+			&GroupEntry{
+				Name:     "group",
+				Password: "x",
+				GID:      42,
+				UserList: []string{"foo"},
+			},
+		},
+	}
+
+	path := filepath.Join(dir, "group")
+	if err := gm.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(path)
+	if string(b) != gm.String() {
+		t.Errorf("Got '%s'; Want '%s'", b, gm.String())
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("Lock left behind")
+	}
+}